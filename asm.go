@@ -0,0 +1,588 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const maxIncludeDepth = 16
+
+// AsmError - an assembler error at a position in a source file
+type AsmError struct {
+	File   string
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (err *AsmError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", err.File, err.Line, err.Column, err.Msg)
+}
+
+// token - a piece of a source line and where it starts
+type token struct {
+	text string
+	file string
+	line int
+	col  int
+}
+
+func (tok token) errorf(format string, args ...interface{}) *AsmError {
+	return &AsmError{File: tok.file, Line: tok.line, Column: tok.col, Msg: fmt.Sprintf(format, args...)}
+}
+
+// statement - an instruction or data directive and its address
+type statement struct {
+	op       token
+	operands []token
+	addr     uint16
+	spec     *opcodeSpec
+}
+
+// assembler - two pass assembler: the first pass parses the source,
+// defines labels and constants and lays out the program, the second
+// encodes it
+type assembler struct {
+	symbols map[string]uint16
+	// label names in definition order, the other symbols are constants
+	labels     []string
+	statements []statement
+	pc         int
+	readFile   func(filename string) ([]byte, error)
+}
+
+func newAssembler() *assembler {
+	return &assembler{
+		symbols:  map[string]uint16{},
+		pc:       startPc,
+		readFile: ioutil.ReadFile,
+	}
+}
+
+// assemble - assembles the source in filename into a ROM loaded at startPc
+func assemble(filename string) ([]byte, error) {
+	return newAssembler().assembleFile(filename)
+}
+
+func (asm *assembler) assembleFile(filename string) ([]byte, error) {
+	src, err := asm.readFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return asm.assemble(filename, string(src))
+}
+
+func (asm *assembler) assemble(filename, src string) ([]byte, error) {
+	if err := asm.parse(filename, src, 0); err != nil {
+		return nil, err
+	}
+	rom := make([]byte, asm.pc-startPc)
+	for _, stmt := range asm.statements {
+		if err := asm.encode(rom[int(stmt.addr)-startPc:], stmt); err != nil {
+			return nil, err
+		}
+	}
+	return rom, nil
+}
+
+func (asm *assembler) parse(filename, src string, depth int) error {
+	for i, line := range strings.Split(src, "\n") {
+		if err := asm.parseLine(filename, i+1, line, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (asm *assembler) parseLine(filename string, lineNum int, line string, depth int) error {
+	tokens, err := tokenize(filename, lineNum, line)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+	// label:
+	if strings.HasSuffix(tokens[0].text, ":") {
+		label := tokens[0]
+		label.text = strings.TrimSuffix(label.text, ":")
+		if err := asm.define(label, uint16(asm.pc)); err != nil {
+			return err
+		}
+		asm.labels = append(asm.labels, label.text)
+		tokens = tokens[1:]
+		if len(tokens) == 0 {
+			return nil
+		}
+	}
+	// NAME equ value
+	if len(tokens) == 2 {
+		fields := strings.Fields(tokens[1].text)
+		if len(fields) > 1 && strings.EqualFold(fields[0], "equ") {
+			expr := tokens[1]
+			expr.text = strings.TrimSpace(expr.text[len(fields[0]):])
+			expr.col += len(tokens[1].text) - len(expr.text)
+			value, err := asm.eval(expr)
+			if err != nil {
+				return err
+			}
+			return asm.define(tokens[0], value)
+		}
+	}
+
+	op := tokens[0]
+	operands := tokens[1:]
+	switch strings.ToLower(op.text) {
+	case "include":
+		if len(operands) != 1 || !isString(operands[0].text) {
+			return op.errorf("include expects a file name in quotes")
+		}
+		if depth >= maxIncludeDepth {
+			return op.errorf("includes nested too deeply")
+		}
+		name := unquote(operands[0].text)
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(filepath.Dir(filename), name)
+		}
+		src, err := asm.readFile(name)
+		if err != nil {
+			return operands[0].errorf("%v", err)
+		}
+		return asm.parse(name, string(src), depth+1)
+	case "org":
+		if len(operands) != 1 {
+			return op.errorf("org expects an address")
+		}
+		addr, err := asm.eval(operands[0])
+		if err != nil {
+			return err
+		}
+		if int(addr) < asm.pc {
+			return operands[0].errorf("org 0x%X is before the current address 0x%X", addr, asm.pc)
+		}
+		asm.pc = int(addr)
+		return nil
+	}
+
+	stmt := statement{op: op, operands: operands, addr: uint16(asm.pc)}
+	size, err := asm.size(&stmt)
+	if err != nil {
+		return err
+	}
+	if asm.pc+size > memorySize {
+		return op.errorf("program does not fit in memory")
+	}
+	asm.pc += size
+	asm.statements = append(asm.statements, stmt)
+	return nil
+}
+
+func (asm *assembler) define(name token, value uint16) error {
+	if !isIdent(name.text) || isReserved(name.text) {
+		return name.errorf("invalid symbol name %q", name.text)
+	}
+	if _, ok := asm.symbols[name.text]; ok {
+		return name.errorf("%s redefined", name.text)
+	}
+	asm.symbols[name.text] = value
+	return nil
+}
+
+// size - the size of stmt in bytes, finds the instruction encoding for
+// instructions
+func (asm *assembler) size(stmt *statement) (int, error) {
+	switch strings.ToLower(stmt.op.text) {
+	case "db":
+		size := 0
+		for _, operand := range stmt.operands {
+			if isString(operand.text) {
+				size += (len(unquote(operand.text)) + 7) / 8
+			} else {
+				size++
+			}
+		}
+		return size, nil
+	case "dw":
+		return 2 * len(stmt.operands), nil
+	}
+	stmt.spec = findSpec(stmt.op.text, stmt.operands)
+	if stmt.spec == nil {
+		return 0, stmt.op.errorf("invalid instruction %s", stmt.text())
+	}
+	return instructionLength(stmt.spec.pattern), nil
+}
+
+func (stmt statement) text() string {
+	operands := make([]string, len(stmt.operands))
+	for i, operand := range stmt.operands {
+		operands[i] = operand.text
+	}
+	return strings.TrimSpace(stmt.op.text + " " + strings.Join(operands, ", "))
+}
+
+// findSpec - the opTable entry for mnemonic with the given operands
+func findSpec(mnemonic string, operands []token) *opcodeSpec {
+	for i := range opTable {
+		spec := &opTable[i]
+		if !strings.EqualFold(spec.mnemonic, mnemonic) {
+			continue
+		}
+		var fields []string
+		if spec.operands != "" {
+			fields = strings.Split(spec.operands, ", ")
+		}
+		if len(fields) != len(operands) {
+			continue
+		}
+		match := true
+		for j, field := range fields {
+			if !operandMatches(field, operands[j].text) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return spec
+		}
+	}
+	return nil
+}
+
+// operandMatches - whether operand has the right form for field, values
+// are range checked when encoding
+func operandMatches(field, operand string) bool {
+	switch field {
+	case "VX", "VY":
+		return isRegister(operand)
+	case "X", "N", "NN", "NNN":
+		return !isRegister(operand) && !isReserved(operand) && !isLong(operand)
+	case "LONG NNNN":
+		return isLong(operand)
+	}
+	return strings.EqualFold(field, operand)
+}
+
+// isLong - whether operand is a LONG address
+func isLong(operand string) bool {
+	fields := strings.Fields(operand)
+	return len(fields) > 1 && strings.EqualFold(fields[0], "long")
+}
+
+func (asm *assembler) encode(out []byte, stmt statement) error {
+	switch strings.ToLower(stmt.op.text) {
+	case "db":
+		i := 0
+		for _, operand := range stmt.operands {
+			if isString(operand.text) {
+				row, err := spriteLiteral(operand)
+				if err != nil {
+					return err
+				}
+				i += copy(out[i:], row)
+				continue
+			}
+			value, err := asm.evalRange(operand, 0xFF)
+			if err != nil {
+				return err
+			}
+			out[i] = uint8(value)
+			i++
+		}
+		return nil
+	case "dw":
+		for i, operand := range stmt.operands {
+			value, err := asm.eval(operand)
+			if err != nil {
+				return err
+			}
+			out[2*i] = uint8(value >> 8)
+			out[2*i+1] = uint8(value)
+		}
+		return nil
+	}
+
+	opcode := stmt.spec.pattern
+	var fields []string
+	if stmt.spec.operands != "" {
+		fields = strings.Split(stmt.spec.operands, ", ")
+	}
+	for i, field := range fields {
+		operand := stmt.operands[i]
+		switch field {
+		case "VX":
+			opcode |= registerNum(operand.text) << 8
+		case "VY":
+			opcode |= registerNum(operand.text) << 4
+		case "X":
+			value, err := asm.evalRange(operand, 0xF)
+			if err != nil {
+				return err
+			}
+			opcode |= value << 8
+		case "N":
+			value, err := asm.evalRange(operand, 0xF)
+			if err != nil {
+				return err
+			}
+			opcode |= value
+		case "NN":
+			value, err := asm.evalRange(operand, 0xFF)
+			if err != nil {
+				return err
+			}
+			opcode |= value
+		case "NNN":
+			value, err := asm.evalRange(operand, 0xFFF)
+			if err != nil {
+				return err
+			}
+			opcode |= value
+		case "LONG NNNN":
+			// skip the LONG keyword
+			expr := operand
+			expr.text = strings.TrimSpace(expr.text[4:])
+			expr.col += len(operand.text) - len(expr.text)
+			value, err := asm.eval(expr)
+			if err != nil {
+				return err
+			}
+			out[2] = uint8(value >> 8)
+			out[3] = uint8(value)
+		}
+	}
+	out[0] = uint8(opcode >> 8)
+	out[1] = uint8(opcode)
+	return nil
+}
+
+func (asm *assembler) evalRange(tok token, max uint16) (uint16, error) {
+	value, err := asm.eval(tok)
+	if err != nil {
+		return 0, err
+	}
+	if value > max {
+		return 0, tok.errorf("value 0x%X out of range, maximum is 0x%X", value, max)
+	}
+	return value, nil
+}
+
+// eval - evaluates sums and differences of numbers and symbols
+func (asm *assembler) eval(tok token) (uint16, error) {
+	var result int
+	sign := 1
+	term := ""
+	terms := 0
+	flush := func() error {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			return tok.errorf("invalid expression %q", tok.text)
+		}
+		value, err := asm.evalTerm(tok, term)
+		if err != nil {
+			return err
+		}
+		result += sign * value
+		terms++
+		term = ""
+		return nil
+	}
+	for i, c := range tok.text {
+		if (c == '+' || c == '-') && (strings.TrimSpace(term) != "" || i > 0) {
+			if err := flush(); err != nil {
+				return 0, err
+			}
+			sign = 1
+			if c == '-' {
+				sign = -1
+			}
+			continue
+		}
+		if c == '-' {
+			sign = -1
+			continue
+		}
+		term += string(c)
+	}
+	if err := flush(); err != nil {
+		return 0, err
+	}
+	if result < -0x8000 || result > 0xFFFF {
+		return 0, tok.errorf("value %d out of range", result)
+	}
+	return uint16(result), nil
+}
+
+func (asm *assembler) evalTerm(tok token, term string) (int, error) {
+	if value, ok := asm.symbols[term]; ok {
+		return int(value), nil
+	}
+	lower := strings.ToLower(term)
+	var value uint64
+	var err error
+	switch {
+	case strings.HasPrefix(lower, "0x"):
+		value, err = strconv.ParseUint(lower[2:], 16, 16)
+	case strings.HasPrefix(lower, "0b"):
+		value, err = strconv.ParseUint(lower[2:], 2, 16)
+	case len(term) > 0 && term[0] >= '0' && term[0] <= '9':
+		value, err = strconv.ParseUint(lower, 10, 16)
+	default:
+		return 0, tok.errorf("undefined symbol %s", term)
+	}
+	if err != nil {
+		return 0, tok.errorf("invalid number %s", term)
+	}
+	return int(value), nil
+}
+
+// spriteLiteral - a sprite line written as a string, "#" or "1" for set
+// pixels and "." or "0" for clear ones, 8 pixels per byte
+func spriteLiteral(tok token) ([]byte, error) {
+	pixels := unquote(tok.text)
+	out := make([]byte, (len(pixels)+7)/8)
+	for i, c := range pixels {
+		switch c {
+		case '#', '1', 'X', 'x':
+			out[i/8] |= 0x80 >> uint(i%8)
+		case '.', '0', ' ', '_':
+		default:
+			return nil, token{tok.text, tok.file, tok.line, tok.col + 1 + i}.errorf("invalid sprite pixel %q", c)
+		}
+	}
+	return out, nil
+}
+
+// tokenize - splits a line into a label, a mnemonic or directive and its
+// comma separated operands, dropping comments
+func tokenize(filename string, lineNum int, line string) ([]token, error) {
+	var tokens []token
+	inString := false
+	start := -1
+	// the first space ends the mnemonic, later ones are part of operands
+	operands := false
+	emit := func(end int) {
+		if start < 0 {
+			return
+		}
+		text := strings.TrimRight(line[start:end], " \t")
+		if text != "" {
+			tokens = append(tokens, token{text, filename, lineNum, start + 1})
+		}
+		start = -1
+	}
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if inString {
+			if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		switch {
+		case c == ';':
+			emit(i)
+			return tokens, nil
+		case c == '"':
+			if start < 0 {
+				start = i
+			}
+			inString = true
+		case c == ',':
+			if !operands || start < 0 {
+				return nil, &AsmError{filename, lineNum, i + 1, "unexpected ,"}
+			}
+			emit(i)
+		case c == ' ' || c == '\t':
+			if start >= 0 && !operands {
+				emit(i)
+				// a label is followed by the mnemonic, not operands
+				if !strings.HasSuffix(tokens[len(tokens)-1].text, ":") {
+					operands = true
+				}
+			}
+		default:
+			if start < 0 {
+				start = i
+			}
+		}
+	}
+	if inString {
+		return nil, &AsmError{filename, lineNum, len(line), "unterminated string"}
+	}
+	emit(len(line))
+	return tokens, nil
+}
+
+func isString(text string) bool {
+	return len(text) >= 2 && text[0] == '"' && text[len(text)-1] == '"'
+}
+
+func unquote(text string) string {
+	return text[1 : len(text)-1]
+}
+
+func isIdent(text string) bool {
+	if text == "" || (text[0] >= '0' && text[0] <= '9') {
+		return false
+	}
+	for _, c := range text {
+		if !(c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func isRegister(text string) bool {
+	return len(text) == 2 && (text[0] == 'V' || text[0] == 'v') && strings.ContainsAny(text[1:], "0123456789abcdefABCDEF")
+}
+
+func registerNum(text string) uint16 {
+	n, _ := strconv.ParseUint(text[1:], 16, 8)
+	return uint16(n)
+}
+
+// isReserved - register names and the keywords used as operands
+func isReserved(text string) bool {
+	switch strings.ToUpper(text) {
+	case "I", "DT", "ST", "K", "F", "HF", "B", "R", "[I]", "LONG":
+		return true
+	}
+	return isRegister(text)
+}
+
+// asmCommand - go-8 asm [-o out.ch8] [-map out.map] source.asm
+func asmCommand(args []string) error {
+	flags := flag.NewFlagSet("asm", flag.ExitOnError)
+	output := flags.String("o", "", "Output file, defaults to the source file with a .ch8 extension.")
+	mapFile := flags.String("map", "", "Source map output file for debugging, e.g. out.map.")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: go-8 asm [-o out.ch8] [-map out.map] source.asm")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	source := flags.Arg(0)
+	asm := newAssembler()
+	rom, err := asm.assembleFile(source)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(source, filepath.Ext(source)) + ".ch8"
+	}
+	if *mapFile != "" {
+		if err := writeSourceMap(asm, *mapFile); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(*output, rom, 0644)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func testAssemble(files map[string]string) ([]byte, error) {
+	asm := newAssembler()
+	asm.readFile = func(filename string) ([]byte, error) {
+		src, ok := files[filename]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return []byte(src), nil
+	}
+	return asm.assembleFile("main.asm")
+}
+
+func TestAssemble(t *testing.T) {
+	files := map[string]string{
+		"main.asm": `; test program
+SPEED equ 2
+start:
+	LD V0, SPEED        ; constant
+	ld i, sprite
+	DRW V0, V1, sprite_end - sprite
+loop: JP loop
+	include "data.asm"
+	dw 0xBEEF, start
+`,
+		"data.asm": `sprite:
+	db "..####..", "...##..."
+	db 0b10000001
+sprite_end:
+`,
+	}
+	rom, err := testAssemble(files)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []byte{
+		0x60, 0x02,
+		0xA2, 0x08,
+		0xD0, 0x13,
+		0x12, 0x06,
+		0x3C, 0x18, 0x81,
+		0xBE, 0xEF, 0x02, 0x00,
+	}
+	if !reflect.DeepEqual(rom, expected) {
+		t.Errorf("Wrong ROM. Got % X, expected % X.", rom, expected)
+	}
+}
+
+func TestAssembleDirectives(t *testing.T) {
+	files := map[string]string{
+		"main.asm": `	LD I, LONG big
+	org 0x208
+big:
+	db "################"
+`,
+	}
+	rom, err := testAssemble(files)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []byte{0xF0, 0x00, 0x02, 0x08, 0, 0, 0, 0, 0xFF, 0xFF}
+	if !reflect.DeepEqual(rom, expected) {
+		t.Errorf("Wrong ROM. Got % X, expected % X.", rom, expected)
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		src    string
+		line   int
+		column int
+	}{
+		{"\tFOO V0", 1, 2},
+		{"\tLD V0, 0x100", 1, 9},
+		{"\n\tJP nowhere", 2, 5},
+		{"a:\na:", 2, 1},
+		{"\tDRW V0, V1, 16", 1, 14},
+		{"\tdb \"..x?\"", 1, 9},
+		{"\tinclude \"missing.asm\"", 1, 10},
+		{"V1:", 1, 1},
+		{"\tLD V0, V1, V2", 1, 2},
+		{"\tdb \"...", 1, 8},
+	}
+	for _, test := range tests {
+		_, err := testAssemble(map[string]string{"main.asm": test.src})
+		asmErr, ok := err.(*AsmError)
+		if !ok {
+			t.Errorf("%q: expected *AsmError, got %v.", test.src, err)
+			continue
+		}
+		if asmErr.File != "main.asm" || asmErr.Line != test.line || asmErr.Column != test.column {
+			t.Errorf("%q: wrong position. Got %v, expected main.asm:%d:%d.", test.src, asmErr, test.line, test.column)
+		}
+	}
+}
+
+func TestAssembleEveryOpcode(t *testing.T) {
+	dis := &disassembler{labels: map[uint16]string{}}
+	for opcode := 0; opcode <= 0xFFFF; opcode++ {
+		inst := Decode(uint16(opcode))
+		if !inst.Valid() {
+			continue
+		}
+		src := "\t" + dis.format(inst, 0x1234)
+		rom, err := testAssemble(map[string]string{"main.asm": src})
+		if err != nil {
+			t.Errorf("%04X: %s: %v", opcode, src, err)
+			continue
+		}
+		encoded := uint16(rom[0])<<8 | uint16(rom[1])
+		if encoded != uint16(opcode) || len(rom) != inst.Length {
+			t.Errorf("%04X: %s assembled to % X.", opcode, src, rom)
+		}
+	}
+}
+
+func TestDisassembleRoundTrip(t *testing.T) {
+	roms := [][]byte{
+		{0xA2, 0x0E, 0x22, 0x0A, 0x30, 0x01, 0x12, 0x04, 0x00, 0xFD, 0xD0, 0x12, 0x00, 0xEE, 0x3C, 0x18, 0xFF, 0xFF, 0x01},
+		{0x12, 0x0C, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0A, 0xF0, 0x00, 0x02, 0x02, 0x00, 0xFD},
+		// jump into the middle of an instruction
+		{0x12, 0x03, 0x60, 0x12, 0x01, 0x00, 0xFD},
+	}
+	for i, rom := range roms {
+		src := disassemble(rom)
+		out, err := testAssemble(map[string]string{"main.asm": src})
+		if err != nil {
+			t.Errorf("ROM %d: %v\n%s", i, err, src)
+			continue
+		}
+		if !reflect.DeepEqual(out, rom) {
+			t.Errorf("ROM %d: round trip mismatch. Got % X, expected % X.\n%s", i, out, rom, src)
+		}
+	}
+}
+
+func ExampleAsmError() {
+	_, err := testAssemble(map[string]string{"main.asm": "\tJP nowhere"})
+	fmt.Println(err)
+	// Output: main.asm:1:5: undefined symbol nowhere
+}
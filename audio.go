@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	patternSize  = 16
+	patternBits  = patternSize * 8
+	defaultPitch = 64
+)
+
+// waveform - shape of the buzzer tone
+type waveform int
+
+const (
+	squareWave waveform = iota
+	triangleWave
+	sawtoothWave
+	sineWave
+)
+
+var waveforms = map[string]waveform{
+	"square":   squareWave,
+	"triangle": triangleWave,
+	"sawtooth": sawtoothWave,
+	"sine":     sineWave,
+}
+
+// getWaveform - the waveform named name
+func getWaveform(name string) (waveform, error) {
+	if w, ok := waveforms[name]; ok {
+		return w, nil
+	}
+	var names []string
+	for name := range waveforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return 0, fmt.Errorf("unknown waveform %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// at - the wave at phase, from 0 to 1 over a period, between -1 and 1
+func (w waveform) at(phase float64) float64 {
+	switch w {
+	case triangleWave:
+		return 1 - 4*math.Abs(phase-0.5)
+	case sawtoothWave:
+		return 2*phase - 1
+	case sineWave:
+		return math.Sin(2 * math.Pi * phase)
+	default:
+		if phase < 0.5 {
+			return 1
+		}
+		return -1
+	}
+}
+
+// tone - the buzzer played while the sound timer runs, and the volume of
+// XO-CHIP patterns too
+type tone struct {
+	frequency float64
+	// from 0 for silence to 1
+	volume   float64
+	waveform waveform
+}
+
+var defaultTone = tone{frequency: 440, volume: 0.2, waveform: squareWave}
+
+// generator - a sound looping until it is stopped
+type generator interface {
+	// generate - fills samples with the sound played at sampleRate,
+	// carrying on where the last call stopped
+	generate(samples []float64, sampleRate int)
+	// period - length of one loop in seconds
+	period() float64
+}
+
+// toneGenerator - generates the buzzer tone
+type toneGenerator struct {
+	tone tone
+	// position in the wave, from 0 to 1
+	phase float64
+}
+
+func newToneGenerator(tone tone) *toneGenerator {
+	return &toneGenerator{tone: tone}
+}
+
+func (gen *toneGenerator) generate(samples []float64, sampleRate int) {
+	step := gen.tone.frequency / float64(sampleRate)
+	for i := range samples {
+		samples[i] = gen.tone.volume * gen.tone.waveform.at(gen.phase)
+		gen.phase = math.Mod(gen.phase+step, 1)
+	}
+}
+
+func (gen *toneGenerator) period() float64 {
+	return 1 / gen.tone.frequency
+}
+
+// audioPattern - XO-CHIP 1-bit audio pattern and its playback pitch
+type audioPattern struct {
+	buffer [patternSize]uint8
+	pitch  uint8
+}
+
+// rate - playback rate in bits per second, 4000 at the default pitch
+func (pattern audioPattern) rate() float64 {
+	return 4000 * math.Pow(2, (float64(pattern.pitch)-defaultPitch)/48)
+}
+
+// patternGenerator - generates samples by looping over a pattern
+type patternGenerator struct {
+	pattern audioPattern
+	volume  float64
+	// position in the pattern, in bits
+	pos float64
+}
+
+func newPatternGenerator(pattern audioPattern, volume float64) *patternGenerator {
+	return &patternGenerator{pattern: pattern, volume: volume}
+}
+
+// generate - fills samples with the pattern played at sampleRate, as a
+// square wave between -volume and volume
+func (gen *patternGenerator) generate(samples []float64, sampleRate int) {
+	step := gen.pattern.rate() / float64(sampleRate)
+	for i := range samples {
+		bit := int(gen.pos)
+		if gen.pattern.buffer[bit/8]&(0x80>>uint(bit%8)) != 0 {
+			samples[i] = gen.volume
+		} else {
+			samples[i] = -gen.volume
+		}
+		gen.pos = math.Mod(gen.pos+step, patternBits)
+	}
+}
+
+func (gen *patternGenerator) period() float64 {
+	return patternBits / gen.pattern.rate()
+}
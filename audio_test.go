@@ -0,0 +1,189 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+type testSound struct {
+	starts  int
+	playing bool
+	gen     generator
+}
+
+func (sound *testSound) start(gen generator) {
+	sound.starts++
+	sound.playing = true
+	sound.gen = gen
+}
+
+func (sound *testSound) stop() {
+	sound.playing = false
+}
+
+func TestPatternRate(t *testing.T) {
+	tests := []struct {
+		pitch    uint8
+		expected float64
+	}{
+		{64, 4000},
+		{112, 8000},
+		{16, 2000},
+	}
+	for _, test := range tests {
+		pattern := audioPattern{pitch: test.pitch}
+		if rate := pattern.rate(); rate < test.expected-0.001 || rate > test.expected+0.001 {
+			t.Errorf("Wrong rate for pitch %d. Got %f, expected %f.", test.pitch, rate, test.expected)
+		}
+	}
+}
+
+func TestPatternGenerator(t *testing.T) {
+	pattern := audioPattern{pitch: defaultPitch}
+	pattern.buffer[0] = 0xA0
+	pattern.buffer[15] = 0x01
+	gen := newPatternGenerator(pattern, 1)
+	// one sample per bit at 4000 Hz
+	samples := make([]float64, 4)
+	gen.generate(samples, 4000)
+	expected := []float64{1, -1, 1, -1}
+	if !reflect.DeepEqual(samples, expected) {
+		t.Errorf("Wrong samples. Got %v, expected %v.", samples, expected)
+	}
+	// the last bit of the pattern, then back to the start
+	gen.pos = patternBits - 1
+	samples = make([]float64, 2)
+	gen.generate(samples, 4000)
+	expected = []float64{1, 1}
+	if !reflect.DeepEqual(samples, expected) {
+		t.Errorf("Pattern did not loop. Got %v, expected %v.", samples, expected)
+	}
+	// two samples per bit at 8000 Hz
+	gen = newPatternGenerator(pattern, 0.5)
+	samples = make([]float64, 4)
+	gen.generate(samples, 8000)
+	expected = []float64{0.5, 0.5, -0.5, -0.5}
+	if !reflect.DeepEqual(samples, expected) {
+		t.Errorf("Wrong samples. Got %v, expected %v.", samples, expected)
+	}
+}
+
+func TestLoadPattern(t *testing.T) {
+	sound := &testSound{}
+	go8 := newGo8(sound, nil, Quirks{}, nil)
+	go8.pc = 0x512
+	go8.opcode = 0xF002
+	go8.index = 0x300
+	for i := 0; i < patternSize; i++ {
+		go8.memory[0x300+i] = uint8(i)
+	}
+	go8.loadPattern()
+	// the pattern is captured when F002 runs
+	go8.memory[0x300] = 0xFF
+	if go8.audio.buffer[0] != 0 || go8.audio.buffer[15] != 15 {
+		t.Errorf("Wrong pattern. Got %v.", go8.audio.buffer)
+	}
+	if !go8.audioLoaded {
+		t.Error("Pattern not marked as loaded.")
+	}
+	if sound.playing {
+		t.Error("Pattern playing with the sound timer at zero.")
+	}
+	checkPc(0x512+2, go8.pc, t)
+}
+
+func TestSetPitch(t *testing.T) {
+	go8 := newGo8(&testSound{}, nil, Quirks{}, nil)
+	go8.pc = 0x512
+	go8.opcode = 0xF13A
+	go8.V[1] = 112
+	go8.setPitch()
+	if go8.audio.pitch != 112 {
+		t.Errorf("Wrong pitch. Got %d, expected %d.", go8.audio.pitch, 112)
+	}
+	checkPc(0x512+2, go8.pc, t)
+}
+
+func TestPatternPlayback(t *testing.T) {
+	sound := &testSound{}
+	go8 := newGo8(sound, nil, Quirks{}, nil)
+	go8.opcode = 0xF002
+	go8.memory[go8.index] = 0xAA
+	go8.loadPattern()
+	go8.opcode = 0xF018
+	go8.V[0] = 2
+	go8.setSound()
+	if gen, ok := sound.gen.(*patternGenerator); !sound.playing || !ok || gen.pattern.buffer[0] != 0xAA {
+		t.Error("Pattern not playing after sound timer was set.")
+	}
+	go8.updateTimers()
+	if !sound.playing {
+		t.Error("Pattern stopped before the sound timer ran out.")
+	}
+	go8.updateTimers()
+	if sound.playing {
+		t.Error("Pattern still playing after the sound timer ran out.")
+	}
+}
+
+func TestBuzzer(t *testing.T) {
+	sound := &testSound{}
+	go8 := newGo8(sound, nil, Quirks{}, nil)
+	go8.opcode = 0xF018
+	go8.V[0] = 3
+	go8.setSound()
+	if gen, ok := sound.gen.(*toneGenerator); !sound.playing || !ok || gen.tone != defaultTone {
+		t.Error("Buzzer not playing as soon as the sound timer was set.")
+	}
+	go8.updateTimers()
+	go8.updateTimers()
+	// setting the timer again while it runs keeps the buzzer going
+	go8.setSound()
+	for i := 0; i < 2; i++ {
+		go8.updateTimers()
+	}
+	if !sound.playing || sound.starts != 1 {
+		t.Errorf("Buzzer stopped or restarted early. Got %d starts.", sound.starts)
+	}
+	go8.updateTimers()
+	if sound.playing {
+		t.Error("Buzzer still playing after the sound timer ran out.")
+	}
+	go8.setSound()
+	go8.V[0] = 0
+	go8.setSound()
+	if sound.playing {
+		t.Error("Buzzer still playing after the sound timer was cleared.")
+	}
+}
+
+func TestToneGenerator(t *testing.T) {
+	tests := []struct {
+		waveform waveform
+		expected []float64
+	}{
+		{squareWave, []float64{0.5, 0.5, -0.5, -0.5, 0.5}},
+		{triangleWave, []float64{-0.5, 0, 0.5, 0, -0.5}},
+		{sawtoothWave, []float64{-0.5, -0.25, 0, 0.25, -0.5}},
+		{sineWave, []float64{0, 0.5, 0, -0.5, 0}},
+	}
+	for _, test := range tests {
+		// four samples per period
+		gen := newToneGenerator(tone{frequency: 1000, volume: 0.5, waveform: test.waveform})
+		samples := make([]float64, 5)
+		gen.generate(samples, 4000)
+		for i := range samples {
+			if math.Abs(samples[i]-test.expected[i]) > 1e-9 {
+				t.Errorf("Wrong %v samples. Got %v, expected %v.", test.waveform, samples, test.expected)
+				break
+			}
+		}
+		if gen.period() != 0.001 {
+			t.Errorf("Wrong period. Got %f, expected %f.", gen.period(), 0.001)
+		}
+	}
+	if _, err := getWaveform("noise"); err == nil {
+		t.Error("No error for an unknown waveform.")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+	"syscall/js"
+)
+
+// canvasKeyName - the key name of a DOM KeyboardEvent.code, which follows
+// key positions rather than the characters on them: Digit1 is 1, KeyQ is
+// Q and ArrowUp is Up
+func canvasKeyName(code string) string {
+	for _, prefix := range []string{"Digit", "Key", "Arrow"} {
+		code = strings.TrimPrefix(code, prefix)
+	}
+	return code
+}
+
+// Canvas - GraphicsDevice drawing to an HTML canvas, one canvas pixel per
+// display pixel so the page scales it with CSS. Keys come from DOM events
+// on the document.
+type Canvas struct {
+	canvas js.Value
+	ctx    js.Value
+	image  js.Value
+	// Uint8Array over the image data and the RGBA pixels copied into it
+	data   js.Value
+	pixels []byte
+	w, h   int
+	pal    palette
+	keymap keymap
+	// keys held down, by name
+	down map[string]bool
+}
+
+func newCanvas(canvas js.Value) *Canvas {
+	c := &Canvas{
+		canvas: canvas,
+		ctx:    canvas.Call("getContext", "2d"),
+		pal:    defaultPalette,
+		keymap: keymaps[defaultKeymap],
+		down:   map[string]bool{},
+	}
+	document := js.Global().Get("document")
+	document.Call("addEventListener", "keydown", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		c.key(args[0], true)
+		return nil
+	}))
+	document.Call("addEventListener", "keyup", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		c.key(args[0], false)
+		return nil
+	}))
+	// key releases are not reported to a page without focus
+	js.Global().Call("addEventListener", "blur", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		c.down = map[string]bool{}
+		return nil
+	}))
+	return c
+}
+
+func (c *Canvas) key(event js.Value, down bool) {
+	name := canvasKeyName(event.Get("code").String())
+	if _, ok := keyName(name); ok {
+		c.down[name] = down
+		event.Call("preventDefault")
+	}
+}
+
+func (c *Canvas) updateWindow(gfx []uint8, w, h int) {
+	if w != c.w || h != c.h {
+		c.w, c.h = w, h
+		c.canvas.Set("width", w)
+		c.canvas.Set("height", h)
+		c.image = c.ctx.Call("createImageData", w, h)
+		c.data = js.Global().Get("Uint8Array").New(c.image.Get("data").Get("buffer"))
+		c.pixels = make([]byte, 4*w*h)
+	}
+	for i, p := range gfx {
+		color := c.pal.color(p)
+		c.pixels[4*i] = color.R
+		c.pixels[4*i+1] = color.G
+		c.pixels[4*i+2] = color.B
+		c.pixels[4*i+3] = 0xFF
+	}
+	js.CopyBytesToJS(c.data, c.pixels)
+	c.ctx.Call("putImageData", c.image, 0, 0)
+}
+
+// closed - a page is never closed while the emulator runs
+func (c *Canvas) closed() bool {
+	return false
+}
+
+func (c *Canvas) pressed(key int) bool {
+	for _, name := range c.keymap[key] {
+		if c.down[name] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// image pixels per hires pixel
+	defaultCaptureScale = 4
+	// browsers play GIF frames shorter than 2/100 s far too slowly, so
+	// recordings run at up to 50 frames per second
+	minGIFDelay = 2
+	// memory the frames of a GIF recording may take, after which it stops:
+	// about 2000 changed frames at the default scale
+	maxGIFSize = 256 << 20
+)
+
+// renderImage - draws the w by h display gfx with scale image pixels per
+// hires pixel. Lores pixels are twice as big, so the image has the same
+// size in both modes.
+func renderImage(gfx []uint8, w, h, scale int, pal palette) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, hiresWidth*scale, hiresHeight*scale), pal.colors())
+	size := hiresWidth * scale / w
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			index := gfx[y*w+x]
+			if index == 0 {
+				continue
+			}
+			for py := y * size; py < (y+1)*size; py++ {
+				row := img.Pix[py*img.Stride+x*size : py*img.Stride+(x+1)*size]
+				for i := range row {
+					row[i] = index
+				}
+			}
+		}
+	}
+	return img
+}
+
+// screenshot - saves the display as a PNG file
+func (emu *Go8) screenshot(filename string, scale int, pal palette) error {
+	w, h := int(emu.width()), int(emu.height())
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, renderImage(emu.gfx[:w*h], w, h, scale, pal)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// capturePath - the first unused file name next to rom with ext, e.g.
+// roms/pong-1.png
+func capturePath(rom, ext string) string {
+	base := strings.TrimSuffix(rom, filepath.Ext(rom))
+	for i := 1; ; i++ {
+		filename := fmt.Sprintf("%s-%d%s", base, i, ext)
+		if _, err := os.Stat(filename); os.IsNotExist(err) {
+			return filename
+		}
+	}
+}
+
+// gifRecorder - GraphicsDevice recording every frame shown on the device
+// it wraps into an animated GIF
+type gifRecorder struct {
+	GraphicsDevice
+	// frames per second the emulator presents
+	frameRate int
+	scale     int
+	pal       palette
+	anim      gif.GIF
+	// frames shown so far, for the timing of the next one
+	frames int
+	// display of the last recorded frame
+	last []uint8
+	// bytes of image data recorded, full once another frame would take
+	// it past limit
+	size  int
+	limit int
+	full  bool
+}
+
+func newGIFRecorder(device GraphicsDevice, frameRate, scale int, pal palette) *gifRecorder {
+	return &gifRecorder{GraphicsDevice: device, frameRate: frameRate, scale: scale, pal: pal, limit: maxGIFSize}
+}
+
+// frameDelay - how long frame is shown at frameRate frames per second, in
+// 1/100 s
+func frameDelay(frame, frameRate int) int {
+	return (frame+1)*100/frameRate - frame*100/frameRate
+}
+
+// updateWindow - records the frame, extending the last one if the display
+// has not changed or replacing it if it has not been shown for long enough.
+// Once the recording is full frames are only passed on.
+func (rec *gifRecorder) updateWindow(gfx []uint8, w, h int) {
+	rec.GraphicsDevice.updateWindow(gfx, w, h)
+	if rec.full {
+		return
+	}
+	delay := frameDelay(rec.frames, rec.frameRate)
+	n := len(rec.anim.Image)
+	switch {
+	case n > 0 && bytes.Equal(gfx, rec.last):
+		rec.anim.Delay[n-1] += delay
+	case n > 0 && rec.anim.Delay[n-1] < minGIFDelay:
+		rec.anim.Image[n-1] = renderImage(gfx, w, h, rec.scale, rec.pal)
+		rec.anim.Delay[n-1] += delay
+	default:
+		img := renderImage(gfx, w, h, rec.scale, rec.pal)
+		if rec.size+len(img.Pix) > rec.limit {
+			rec.full = true
+			return
+		}
+		rec.size += len(img.Pix)
+		rec.anim.Image = append(rec.anim.Image, img)
+		rec.anim.Delay = append(rec.anim.Delay, delay)
+	}
+	rec.frames++
+	rec.last = append(rec.last[:0], gfx...)
+}
+
+// limitReached - a note on how much a full recording holds
+func (rec *gifRecorder) limitReached() string {
+	return fmt.Sprintf("GIF recording stopped after %d frames at the %d MiB limit", rec.frames, rec.limit>>20)
+}
+
+func (rec *gifRecorder) write(w io.Writer) error {
+	if len(rec.anim.Image) == 0 {
+		return fmt.Errorf("gif: no frames recorded")
+	}
+	return gif.EncodeAll(w, &rec.anim)
+}
+
+func (rec *gifRecorder) save(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := rec.write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testPalette = palette{
+	{0x10, 0x20, 0x30, 0xFF},
+	{0xFF, 0x00, 0x00, 0xFF},
+	{0x00, 0xFF, 0x00, 0xFF},
+	{0x00, 0x00, 0xFF, 0xFF},
+}
+
+func TestRenderImage(t *testing.T) {
+	tests := []struct {
+		name string
+		w, h int
+		// image pixels per display pixel at scale 2
+		size int
+	}{
+		{"lores", screenWidth, screenHeight, 4},
+		{"hires", hiresWidth, hiresHeight, 2},
+	}
+	for _, test := range tests {
+		gfx := make([]uint8, test.w*test.h)
+		gfx[1] = 1
+		gfx[test.w] = 2
+		gfx[test.w+1] = 3
+		img := renderImage(gfx, test.w, test.h, 2, testPalette)
+		if bounds := img.Bounds(); bounds.Dx() != hiresWidth*2 || bounds.Dy() != hiresHeight*2 {
+			t.Errorf("%s: Wrong image size. Got %v.", test.name, bounds)
+		}
+		s := test.size
+		expected := []struct {
+			x, y  int
+			color color.RGBA
+		}{
+			{0, 0, testPalette[0]},
+			{s - 1, s - 1, testPalette[0]},
+			{s, 0, testPalette[1]},
+			{2*s - 1, s - 1, testPalette[1]},
+			{2 * s, 0, testPalette[0]},
+			{0, s, testPalette[2]},
+			{s, 2*s - 1, testPalette[3]},
+			{0, 2 * s, testPalette[0]},
+		}
+		for _, e := range expected {
+			if got := img.At(e.x, e.y); got != e.color {
+				t.Errorf("%s: Wrong colour at %d,%d. Got %v, expected %v.", test.name, e.x, e.y, got, e.color)
+			}
+		}
+	}
+}
+
+func TestScreenshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	go8 := Go8{}
+	go8.initialize()
+	go8.gfx[screenWidth+2] = 1
+	filename := capturePath(filepath.Join(dir, "game.ch8"), ".png")
+	if filename != filepath.Join(dir, "game-1.png") {
+		t.Errorf("Wrong screenshot path. Got %s.", filename)
+	}
+	if err := go8.screenshot(filename, 1, testPalette); err != nil {
+		t.Fatal(err)
+	}
+	if next := capturePath(filepath.Join(dir, "game.ch8"), ".png"); next != filepath.Join(dir, "game-2.png") {
+		t.Errorf("Wrong path after a screenshot. Got %s.", next)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, g, b, _ := img.At(5, 3).RGBA()
+	if r>>8 != 0xFF || g != 0 || b != 0 {
+		t.Errorf("Wrong colour at 5,3. Got %x %x %x.", r>>8, g>>8, b>>8)
+	}
+	if r, _, _, _ := img.At(6, 3).RGBA(); r>>8 != 0x10 {
+		t.Errorf("Wrong background colour. Got red %x, expected %x.", r>>8, 0x10)
+	}
+}
+
+func TestGIFRecorder(t *testing.T) {
+	graphics := &testGraphics{}
+	rec := newGIFRecorder(graphics, timerRate, 1, testPalette)
+	gfx := make([]uint8, screenWidth*screenHeight)
+	// a frame that changes every frame, then one that stays for a second
+	for i := 0; i < 6; i++ {
+		gfx[0] = uint8(i & 1)
+		rec.updateWindow(gfx, screenWidth, screenHeight)
+	}
+	gfx[1] = 1
+	for i := 0; i < 60; i++ {
+		rec.updateWindow(gfx, screenWidth, screenHeight)
+	}
+	if len(graphics.frames) != 66 {
+		t.Errorf("Frames not passed on. Got %d, expected %d.", len(graphics.frames), 66)
+	}
+	total := 0
+	for i, delay := range rec.anim.Delay {
+		if delay < minGIFDelay {
+			t.Errorf("Frame %d too short. Got %d, expected at least %d.", i, delay, minGIFDelay)
+		}
+		total += delay
+	}
+	if total != 110 {
+		t.Errorf("Wrong length. Got %d/100 s, expected %d.", total, 110)
+	}
+	if last := rec.anim.Delay[len(rec.anim.Delay)-1]; last < 100 {
+		t.Errorf("Unchanged frames not merged. Got a last delay of %d.", last)
+	}
+	var buf bytes.Buffer
+	if err := rec.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != len(rec.anim.Image) {
+		t.Errorf("Wrong number of frames. Got %d, expected %d.", len(anim.Image), len(rec.anim.Image))
+	}
+	if err := newGIFRecorder(graphics, timerRate, 1, testPalette).write(&buf); err == nil {
+		t.Error("No error writing an empty GIF.")
+	}
+}
+
+func TestGIFRecorderLimit(t *testing.T) {
+	graphics := &testGraphics{}
+	rec := newGIFRecorder(graphics, timerRate, 1, testPalette)
+	frameSize := hiresWidth * hiresHeight
+	rec.limit = 3 * frameSize
+	gfx := make([]uint8, screenWidth*screenHeight)
+	for i := 0; i < 10; i++ {
+		gfx[i] = 1
+		// shown long enough to be kept
+		rec.updateWindow(gfx, screenWidth, screenHeight)
+		rec.updateWindow(gfx, screenWidth, screenHeight)
+	}
+	if !rec.full || len(rec.anim.Image) != 3 || rec.size != 3*frameSize {
+		t.Errorf("Recording not limited. Got %d frames of %d bytes, full %t, expected 3 of %d.",
+			len(rec.anim.Image), rec.size, rec.full, 3*frameSize)
+	}
+	if len(graphics.frames) != 20 {
+		t.Errorf("Frames not passed on once full. Got %d, expected 20.", len(graphics.frames))
+	}
+	if rec.frames != 6 || !strings.Contains(rec.limitReached(), "after 6 frames") {
+		t.Errorf("Wrong frames recorded. Got %d: %s.", rec.frames, rec.limitReached())
+	}
+	var buf bytes.Buffer
+	if err := rec.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFrameDelay(t *testing.T) {
+	for _, frameRate := range []int{60, 30, 50, 120, 24} {
+		total := 0
+		for frame := 0; frame < frameRate; frame++ {
+			total += frameDelay(frame, frameRate)
+		}
+		if total != 100 {
+			t.Errorf("%d fps: Wrong length of a second. Got %d/100 s, expected 100.", frameRate, total)
+		}
+	}
+	if delay := frameDelay(0, 30); delay != 3 {
+		t.Errorf("Wrong delay at 30 fps. Got %d/100 s, expected 3.", delay)
+	}
+}
+
+func TestHeadlessCapture(t *testing.T) {
+	rom := writeTestROM(t, []uint8{
+		0xF0, 0x29, // 200: index = font V0
+		0xD0, 0x05, // 202: draw
+		0x70, 0x01, // 204: V0 += 1
+		0x12, 0x00, // 206: loop
+	})
+	dir := filepath.Dir(rom)
+	defer os.RemoveAll(dir)
+	opts := options{
+		rom:            rom,
+		cyclesPerFrame: 4,
+		frames:         30,
+		screenshot:     filepath.Join(dir, "out.png"),
+		gif:            filepath.Join(dir, "out.gif"),
+		scale:          2,
+	}
+	if err := runHeadless(opts, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(opts.gif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	anim, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) < 2 {
+		t.Errorf("Wrong number of frames. Got %d.", len(anim.Image))
+	}
+	if _, err := os.Stat(opts.screenshot); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultConfigPath - the config file read when -config is not given,
+// e.g. ~/.config/go-8/config on Linux
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "go-8", "config")
+}
+
+// applyConfig - sets the flags named in a config file that were not given
+// on the command line. Each line is a flag name and its value, e.g.
+// "palette = octo"; blank lines and lines starting with # are skipped. A
+// missing file is only an error if required is set.
+func applyConfig(flags *flag.FlagSet, filename string, required bool) error {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) && !required {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		parts := strings.SplitN(text, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("%s:%d: expected name = value", filename, line)
+		}
+		name, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if flags.Lookup(name) == nil {
+			return fmt.Errorf("%s:%d: unknown setting %q", filename, line, name)
+		}
+		if set[name] {
+			continue
+		}
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("%s:%d: invalid value %q for %s: %v", filename, line, value, name, err)
+		}
+	}
+	return scanner.Err()
+}
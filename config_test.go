@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyConfig(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"good": `# display
+palette = octo
+scale=2
+
+volume = 0.5
+`,
+		"unknown": "colour = red\n",
+		"syntax":  "palette octo\n",
+		"value":   "scale = big\n",
+	})
+	defer os.RemoveAll(dir)
+	newFlags := func() (*flag.FlagSet, *string, *int, *float64) {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.SetOutput(&strings.Builder{})
+		return flags, flags.String("palette", "default", ""), flags.Int("scale", 4, ""), flags.Float64("volume", 0.2, "")
+	}
+
+	flags, pal, scale, volume := newFlags()
+	flags.Parse([]string{"-scale", "3"})
+	if err := applyConfig(flags, filepath.Join(dir, "good"), true); err != nil {
+		t.Fatal(err)
+	}
+	// the command line wins over the config file
+	if *pal != "octo" || *scale != 3 || *volume != 0.5 {
+		t.Errorf("Wrong settings. Got palette %s, scale %d, volume %g.", *pal, *scale, *volume)
+	}
+
+	tests := []struct {
+		file string
+		err  string
+	}{
+		{"unknown", "unknown:1: unknown setting \"colour\""},
+		{"syntax", "syntax:1: expected name = value"},
+		{"value", "value:1: invalid value"},
+	}
+	for _, test := range tests {
+		flags, _, _, _ := newFlags()
+		err := applyConfig(flags, filepath.Join(dir, test.file), true)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: Wrong error. Got %v, expected %s.", test.file, err, test.err)
+		}
+	}
+	flags, _, _, _ = newFlags()
+	if err := applyConfig(flags, filepath.Join(dir, "missing"), true); !os.IsNotExist(err) {
+		t.Errorf("Wrong error for a missing config file. Got %v.", err)
+	}
+	if err := applyConfig(flags, filepath.Join(dir, "missing"), false); err != nil {
+		t.Errorf("Error for a missing optional config file: %v", err)
+	}
+}
@@ -0,0 +1,585 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dapThreadID = 1
+
+// dapRequest - a Debug Adapter Protocol request from the client
+type dapRequest struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+	// connection the request came from, responses are written to it
+	out io.Writer
+}
+
+type dapResponse struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Success    bool        `json:"success"`
+	Command    string      `json:"command"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+// readDAPMessage - reads one message with its Content-Length header
+func readDAPMessage(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if value := strings.TrimPrefix(line, "Content-Length:"); value != line {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("dap: invalid Content-Length %q", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("dap: missing Content-Length")
+	}
+	data := make([]byte, length)
+	_, err := io.ReadFull(r, data)
+	return data, err
+}
+
+func writeDAPMessage(w io.Writer, message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return err
+}
+
+// dapServer - Debug Adapter Protocol server. Requests are read on their
+// own goroutine and handled in beforeCycle, so the emulator state is only
+// touched between instructions.
+type dapServer struct {
+	emu      *Go8
+	requests chan dapRequest
+	out      io.Writer
+	seq      int
+	// ROM and source map, set by the launch request or the command line
+	program string
+	symbols *sourceMap
+	// breakpoint addresses by source file
+	sources     map[string][]uint16
+	breakpoints map[uint16]bool
+	paused      bool
+	// set when execution resumes, so the instruction it resumes at runs
+	// before breakpoints are checked again
+	resumed bool
+	// stop condition of the step in progress
+	until       func() bool
+	stopOnEntry bool
+	// quit when the client disconnects, set if the session started the
+	// program
+	terminate bool
+}
+
+func newDAPServer(emu *Go8) *dapServer {
+	return &dapServer{
+		emu:         emu,
+		requests:    make(chan dapRequest),
+		out:         ioutil.Discard,
+		sources:     map[string][]uint16{},
+		breakpoints: map[uint16]bool{},
+	}
+}
+
+// serve - reads requests from r until EOF, then disconnects
+func (dap *dapServer) serve(r io.Reader, w io.Writer) {
+	in := bufio.NewReader(r)
+	for {
+		data, err := readDAPMessage(in)
+		if err != nil {
+			break
+		}
+		var req dapRequest
+		if err := json.Unmarshal(data, &req); err != nil || req.Type != "request" {
+			continue
+		}
+		req.out = w
+		dap.requests <- req
+		if req.Command == "disconnect" {
+			return
+		}
+	}
+	dap.requests <- dapRequest{Command: "disconnect", Arguments: json.RawMessage("{}"), out: w}
+}
+
+// listen - serves one client at a time on addr
+func (dap *dapServer) listen(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			dap.serve(conn, conn)
+			conn.Close()
+		}
+	}()
+	return nil
+}
+
+// beforeCycle - handles pending requests, then pauses if a breakpoint was
+// hit or a step finished, serving requests until execution resumes
+func (dap *dapServer) beforeCycle() error {
+	if err := dap.poll(); err != nil {
+		return err
+	}
+	for {
+		if dap.paused {
+			if err := dap.wait(); err != nil {
+				return err
+			}
+			continue
+		}
+		if dap.resumed {
+			dap.resumed = false
+			return nil
+		}
+		reason := ""
+		switch {
+		case dap.breakpoints[dap.emu.pc]:
+			reason = "breakpoint"
+		case dap.until != nil && dap.until():
+			reason = "step"
+		}
+		if reason == "" {
+			return nil
+		}
+		dap.stop(reason, "")
+	}
+}
+
+// poll - handles the requests that arrived while running
+func (dap *dapServer) poll() error {
+	for {
+		select {
+		case req := <-dap.requests:
+			if err := dap.handle(req); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// report - pauses on an instruction that failed with err
+func (dap *dapServer) report(err error) error {
+	dap.stop("exception", err.Error())
+	for dap.paused {
+		if err := dap.wait(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exit - tells the client the program has ended
+func (dap *dapServer) exit() {
+	dap.event("exited", map[string]int{"exitCode": 0})
+	dap.event("terminated", nil)
+}
+
+// wait - handles one request while paused, keeping the display updated
+func (dap *dapServer) wait() error {
+	frame := time.NewTimer(time.Second / 60)
+	defer frame.Stop()
+	select {
+	case req := <-dap.requests:
+		return dap.handle(req)
+	case <-frame.C:
+		if dap.emu.graphics != nil {
+			dap.emu.updateWindow()
+			if dap.emu.graphics.closed() {
+				return errQuit
+			}
+		}
+	}
+	return nil
+}
+
+func (dap *dapServer) stop(reason, text string) {
+	dap.paused = true
+	dap.until = nil
+	body := map[string]interface{}{
+		"reason":            reason,
+		"threadId":          dapThreadID,
+		"allThreadsStopped": true,
+	}
+	if text != "" {
+		body["text"] = text
+	}
+	dap.event("stopped", body)
+}
+
+func (dap *dapServer) resume(until func() bool) {
+	dap.paused = false
+	dap.resumed = true
+	dap.until = until
+}
+
+func (dap *dapServer) event(name string, body interface{}) {
+	dap.seq++
+	writeDAPMessage(dap.out, dapEvent{Seq: dap.seq, Type: "event", Event: name, Body: body})
+}
+
+func (dap *dapServer) respond(req dapRequest, body interface{}, err error) {
+	dap.seq++
+	resp := dapResponse{
+		Seq:        dap.seq,
+		Type:       "response",
+		RequestSeq: req.Seq,
+		Success:    err == nil,
+		Command:    req.Command,
+		Body:       body,
+	}
+	if err != nil {
+		resp.Message = err.Error()
+	}
+	writeDAPMessage(req.out, resp)
+}
+
+// handle - runs a request and responds to it
+func (dap *dapServer) handle(req dapRequest) error {
+	dap.out = req.out
+	if len(req.Arguments) == 0 {
+		req.Arguments = json.RawMessage("{}")
+	}
+	var body interface{}
+	var err error
+	switch req.Command {
+	case "initialize":
+		body = map[string]bool{
+			"supportsConfigurationDoneRequest": true,
+			"supportsReadMemoryRequest":        true,
+			"supportsTerminateRequest":         true,
+		}
+		dap.respond(req, body, nil)
+		dap.event("initialized", nil)
+		return nil
+	case "launch":
+		err = dap.launch(req.Arguments)
+	case "attach":
+		err = dap.attach(req.Arguments)
+	case "setBreakpoints":
+		body, err = dap.setBreakpoints(req.Arguments)
+	case "configurationDone":
+		dap.respond(req, nil, nil)
+		if dap.stopOnEntry {
+			dap.stop("entry", "")
+		} else if dap.paused {
+			dap.paused = false
+		}
+		return nil
+	case "threads":
+		body = map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": dapThreadID, "name": "CHIP-8"}},
+		}
+	case "stackTrace":
+		body = dap.stackTrace()
+	case "scopes":
+		body = map[string]interface{}{
+			"scopes": []map[string]interface{}{
+				{"name": "Registers", "variablesReference": 1, "expensive": false},
+				{"name": "Timers", "variablesReference": 2, "expensive": false},
+			},
+		}
+	case "variables":
+		body, err = dap.variables(req.Arguments)
+	case "readMemory":
+		body, err = dap.readMemory(req.Arguments)
+	case "continue":
+		dap.resume(nil)
+		body = map[string]bool{"allThreadsContinued": true}
+	case "next":
+		dap.resume(dap.stepOver())
+	case "stepIn":
+		dap.resume(func() bool { return true })
+	case "stepOut":
+		sp := dap.emu.sp
+		dap.resume(func() bool { return dap.emu.sp < sp })
+	case "pause":
+		dap.respond(req, nil, nil)
+		dap.stop("pause", "")
+		return nil
+	case "disconnect", "terminate":
+		var args struct {
+			TerminateDebuggee *bool `json:"terminateDebuggee"`
+		}
+		json.Unmarshal(req.Arguments, &args)
+		dap.respond(req, nil, nil)
+		if req.Command == "terminate" || dap.terminate || args.TerminateDebuggee != nil && *args.TerminateDebuggee {
+			return errQuit
+		}
+		// leave the program running without the debugger
+		dap.sources = map[string][]uint16{}
+		dap.breakpoints = map[uint16]bool{}
+		dap.paused, dap.until = false, nil
+		return nil
+	default:
+		err = fmt.Errorf("unsupported request %s", req.Command)
+	}
+	dap.respond(req, body, err)
+	return nil
+}
+
+// launch - restarts the emulator with the program given by the client
+func (dap *dapServer) launch(arguments json.RawMessage) error {
+	var args struct {
+		Program     string `json:"program"`
+		Quirks      string `json:"quirks"`
+		SourceMap   string `json:"sourceMap"`
+		StopOnEntry bool   `json:"stopOnEntry"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return err
+	}
+	if args.Program == "" {
+		return fmt.Errorf("launch: no program given")
+	}
+	if args.Quirks != "" {
+		quirks, err := getQuirks(args.Quirks)
+		if err != nil {
+			return err
+		}
+		dap.emu.quirks = quirks
+	}
+	dap.emu.initialize()
+	if err := dap.emu.loadROM(args.Program); err != nil {
+		return err
+	}
+	dap.program = args.Program
+	dap.stopOnEntry = args.StopOnEntry
+	dap.terminate = true
+	// wait for configurationDone
+	dap.paused = true
+	dap.resumed = false
+	return dap.loadSymbols(args.SourceMap)
+}
+
+// attach - debugs the program already running
+func (dap *dapServer) attach(arguments json.RawMessage) error {
+	var args struct {
+		SourceMap   string `json:"sourceMap"`
+		StopOnEntry bool   `json:"stopOnEntry"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return err
+	}
+	dap.stopOnEntry = args.StopOnEntry
+	return dap.loadSymbols(args.SourceMap)
+}
+
+// loadSymbols - loads the source map in filename, or the one next to the
+// program with a .map extension if there is one
+func (dap *dapServer) loadSymbols(filename string) error {
+	dap.symbols = nil
+	if filename == "" {
+		if dap.program == "" {
+			return nil
+		}
+		filename = strings.TrimSuffix(dap.program, filepath.Ext(dap.program)) + ".map"
+		if _, err := os.Stat(filename); err != nil {
+			return nil
+		}
+	}
+	symbols, err := loadSourceMap(filename)
+	if err != nil {
+		return err
+	}
+	dap.symbols = symbols
+	return nil
+}
+
+func (dap *dapServer) setBreakpoints(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		Source struct {
+			Path string `json:"path"`
+		} `json:"source"`
+		Breakpoints []struct {
+			Line int `json:"line"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	var addrs []uint16
+	breakpoints := []map[string]interface{}{}
+	for _, bp := range args.Breakpoints {
+		result := map[string]interface{}{"verified": false, "line": bp.Line}
+		if dap.symbols == nil {
+			result["message"] = "no source map"
+		} else if addr, line, ok := dap.symbols.address(args.Source.Path, bp.Line); ok {
+			addrs = append(addrs, addr)
+			result["verified"] = true
+			result["line"] = line
+			result["instructionReference"] = fmt.Sprintf("0x%03X", addr)
+		} else {
+			result["message"] = "no code at or after this line"
+		}
+		breakpoints = append(breakpoints, result)
+	}
+	dap.sources[filepath.Clean(args.Source.Path)] = addrs
+	dap.breakpoints = map[uint16]bool{}
+	for _, addrs := range dap.sources {
+		for _, addr := range addrs {
+			dap.breakpoints[addr] = true
+		}
+	}
+	return map[string]interface{}{"breakpoints": breakpoints}, nil
+}
+
+// stepOver - the stop condition for next: after a call returns, or after
+// one instruction otherwise
+func (dap *dapServer) stepOver() func() bool {
+	emu := dap.emu
+	inst := Decode(emu.getOpcode())
+	if inst.Mnemonic != "CALL" {
+		return func() bool { return true }
+	}
+	pc, sp := emu.pc+2, emu.sp
+	return func() bool { return emu.pc == pc && emu.sp == sp }
+}
+
+// stackTrace - the current instruction, then the calls on the stack
+func (dap *dapServer) stackTrace() interface{} {
+	emu := dap.emu
+	addrs := []uint16{emu.pc}
+	for i := int(emu.sp) - 1; i >= 0 && i < len(emu.stack); i-- {
+		addrs = append(addrs, emu.stack[i])
+	}
+	frames := []map[string]interface{}{}
+	for i, addr := range addrs {
+		frame := map[string]interface{}{
+			"id":                          i,
+			"name":                        fmt.Sprintf("0x%03X", addr),
+			"line":                        0,
+			"column":                      0,
+			"instructionPointerReference": fmt.Sprintf("0x%03X", addr),
+		}
+		if dap.symbols != nil {
+			if name, ok := dap.symbols.symbol(addr); ok {
+				frame["name"] = name
+			}
+			if source, ok := dap.symbols.lines[addr]; ok {
+				frame["source"] = map[string]string{
+					"name": filepath.Base(source.file),
+					"path": source.file,
+				}
+				frame["line"] = source.line
+				frame["column"] = 1
+			}
+		}
+		frames = append(frames, frame)
+	}
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}
+}
+
+func (dap *dapServer) variables(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		VariablesReference int `json:"variablesReference"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	emu := dap.emu
+	variable := func(name, value string) map[string]interface{} {
+		return map[string]interface{}{"name": name, "value": value, "variablesReference": 0}
+	}
+	variables := []map[string]interface{}{}
+	switch args.VariablesReference {
+	case 1:
+		for i, v := range emu.V {
+			variables = append(variables, variable(fmt.Sprintf("V%X", i), fmt.Sprintf("0x%02X", v)))
+		}
+		index := variable("I", fmt.Sprintf("0x%03X", emu.index))
+		index["memoryReference"] = fmt.Sprintf("0x%X", emu.index)
+		variables = append(variables,
+			index,
+			variable("PC", fmt.Sprintf("0x%03X", emu.pc)),
+			variable("SP", fmt.Sprintf("%d", emu.sp)))
+	case 2:
+		variables = append(variables,
+			variable("DT", fmt.Sprintf("%d", emu.delayTimer)),
+			variable("ST", fmt.Sprintf("%d", emu.soundTimer)))
+	default:
+		return nil, fmt.Errorf("unknown variables reference %d", args.VariablesReference)
+	}
+	return map[string]interface{}{"variables": variables}, nil
+}
+
+func (dap *dapServer) readMemory(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		MemoryReference string `json:"memoryReference"`
+		Offset          int    `json:"offset"`
+		Count           int    `json:"count"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	base, err := strconv.ParseInt(args.MemoryReference, 0, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid memory reference %q", args.MemoryReference)
+	}
+	if args.Count < 0 {
+		args.Count = 0
+	}
+	// the requested range, cut down to the part inside memory
+	start := int(base) + args.Offset
+	end := start + args.Count
+	if start < 0 {
+		start = 0
+	}
+	if start > memorySize {
+		start = memorySize
+	}
+	if end > memorySize {
+		end = memorySize
+	}
+	if end < start {
+		end = start
+	}
+	return map[string]interface{}{
+		"address":         fmt.Sprintf("0x%X", start),
+		"data":            base64.StdEncoding.EncodeToString(dap.emu.memory[start:end]),
+		"unreadableBytes": args.Count - (end - start),
+	}, nil
+}
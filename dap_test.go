@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testDAPSource = `start:
+	LD V0, 5
+	CALL sub
+	LD V1, 7
+	EXIT
+sub:
+	ADD V0, 1
+	RET
+`
+
+type testDAPMessage struct {
+	Type       string          `json:"type"`
+	Command    string          `json:"command"`
+	Event      string          `json:"event"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// testDAPClient - talks to a DAP server running the emulator on its own
+// goroutine, the way the emulator runs from main
+type testDAPClient struct {
+	t      *testing.T
+	in     io.WriteCloser
+	out    *bufio.Reader
+	seq    int
+	events []testDAPMessage
+	done   chan error
+}
+
+func startTestDAP(t *testing.T) *testDAPClient {
+	go8 := newGo8(&testSound{}, &testGraphics{}, Quirks{}, nil)
+	dap := newDAPServer(go8)
+	dap.paused = true
+	dap.terminate = true
+	go8.beforeCycle = dap.beforeCycle
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	go dap.serve(inR, outW)
+	client := &testDAPClient{t: t, in: inW, out: bufio.NewReader(outR), done: make(chan error, 1)}
+	go func() {
+		for !go8.exited {
+			err := go8.RunFrame()
+			if err != nil && err != errQuit {
+				err = dap.report(err)
+			}
+			if err != nil {
+				client.done <- err
+				return
+			}
+		}
+		dap.exit()
+		client.done <- nil
+	}()
+	return client
+}
+
+func (c *testDAPClient) read() testDAPMessage {
+	data, err := readDAPMessage(c.out)
+	if err != nil {
+		c.t.Fatalf("Reading message: %v", err)
+	}
+	var msg testDAPMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		c.t.Fatalf("Invalid message %s: %v", data, err)
+	}
+	return msg
+}
+
+// request - sends a request and returns the body of its response, keeping
+// the events that come before it
+func (c *testDAPClient) request(command string, args interface{}, body interface{}) {
+	c.seq++
+	writeDAPMessage(c.in, map[string]interface{}{
+		"seq": c.seq, "type": "request", "command": command, "arguments": args,
+	})
+	for {
+		msg := c.read()
+		if msg.Type == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+		if msg.RequestSeq != c.seq || msg.Command != command {
+			c.t.Fatalf("Wrong response. Got %s %d, expected %s %d.", msg.Command, msg.RequestSeq, command, c.seq)
+		}
+		if !msg.Success {
+			c.t.Fatalf("%s failed: %s", command, msg.Message)
+		}
+		if body != nil {
+			json.Unmarshal(msg.Body, body)
+		}
+		return
+	}
+}
+
+// event - waits for the event name, returning its body
+func (c *testDAPClient) event(name string, body interface{}) {
+	for {
+		var msg testDAPMessage
+		if len(c.events) > 0 {
+			msg, c.events = c.events[0], c.events[1:]
+		} else {
+			msg = c.read()
+		}
+		if msg.Type == "event" && msg.Event == name {
+			if body != nil {
+				json.Unmarshal(msg.Body, body)
+			}
+			return
+		}
+	}
+}
+
+type testStopped struct {
+	Reason string `json:"reason"`
+}
+
+type testStackTrace struct {
+	StackFrames []struct {
+		Name   string `json:"name"`
+		Line   int    `json:"line"`
+		Source struct {
+			Path string `json:"path"`
+		} `json:"source"`
+	} `json:"stackFrames"`
+}
+
+type testVariables struct {
+	Variables []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"variables"`
+}
+
+func (c *testDAPClient) stop(reason string) {
+	var stopped testStopped
+	c.event("stopped", &stopped)
+	if stopped.Reason != reason {
+		c.t.Errorf("Wrong stop reason. Got %s, expected %s.", stopped.Reason, reason)
+	}
+}
+
+// frames - the stack trace as name:line pairs
+func (c *testDAPClient) frames() string {
+	var trace testStackTrace
+	c.request("stackTrace", map[string]int{"threadId": dapThreadID}, &trace)
+	var frames []string
+	for _, frame := range trace.StackFrames {
+		frames = append(frames, fmt.Sprintf("%s:%s:%d", frame.Name, filepath.Base(frame.Source.Path), frame.Line))
+	}
+	return strings.Join(frames, " ")
+}
+
+func (c *testDAPClient) register(name string) string {
+	var vars testVariables
+	c.request("variables", map[string]int{"variablesReference": 1}, &vars)
+	for _, v := range vars.Variables {
+		if v.Name == name {
+			return v.Value
+		}
+	}
+	return ""
+}
+
+// launchTestDAP - assembles testDAPSource with a source map and launches it
+// with breakpoints on lines
+func launchTestDAP(t *testing.T, lines ...int) (*testDAPClient, string) {
+	dir := writeTestFiles(t, map[string]string{"main.asm": testDAPSource})
+	source := filepath.Join(dir, "main.asm")
+	asm := newAssembler()
+	rom, err := asm.assembleFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "main.ch8"), rom, 0644)
+	if err := writeSourceMap(asm, filepath.Join(dir, "main.map")); err != nil {
+		t.Fatal(err)
+	}
+	c := startTestDAP(t)
+	c.request("initialize", map[string]string{"adapterID": "go-8"}, nil)
+	c.event("initialized", nil)
+	c.request("launch", map[string]string{"program": filepath.Join(dir, "main.ch8")}, nil)
+	var breakpoints []map[string]int
+	for _, line := range lines {
+		breakpoints = append(breakpoints, map[string]int{"line": line})
+	}
+	var result struct {
+		Breakpoints []struct {
+			Verified bool `json:"verified"`
+			Line     int  `json:"line"`
+		} `json:"breakpoints"`
+	}
+	c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]string{"path": source},
+		"breakpoints": breakpoints,
+	}, &result)
+	for i, bp := range result.Breakpoints {
+		if !bp.Verified {
+			t.Errorf("Breakpoint on line %d not verified.", lines[i])
+		}
+	}
+	c.request("configurationDone", nil, nil)
+	return c, dir
+}
+
+func (c *testDAPClient) disconnect() {
+	c.request("disconnect", nil, nil)
+	c.in.Close()
+	if err := <-c.done; err != nil && err != errQuit {
+		c.t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestDAPStepping(t *testing.T) {
+	c, dir := launchTestDAP(t, 3)
+	defer os.RemoveAll(dir)
+	c.stop("breakpoint")
+	if frames := c.frames(); frames != "start:main.asm:3" {
+		t.Errorf("Wrong stack trace. Got %s.", frames)
+	}
+	c.request("stepIn", map[string]int{"threadId": dapThreadID}, nil)
+	c.stop("step")
+	if frames := c.frames(); frames != "sub:main.asm:7 start:main.asm:3" {
+		t.Errorf("Wrong stack trace in subroutine. Got %s.", frames)
+	}
+	c.request("stepOut", map[string]int{"threadId": dapThreadID}, nil)
+	c.stop("step")
+	if frames := c.frames(); frames != "start:main.asm:4" {
+		t.Errorf("Wrong stack trace after step out. Got %s.", frames)
+	}
+	if v0 := c.register("V0"); v0 != "0x06" {
+		t.Errorf("Wrong V0. Got %s, expected %s.", v0, "0x06")
+	}
+	var memory struct {
+		Address string `json:"address"`
+		Data    []byte `json:"data"`
+	}
+	c.request("readMemory", map[string]interface{}{"memoryReference": "0x200", "offset": 2, "count": 2}, &memory)
+	if memory.Address != "0x202" || !bytes.Equal(memory.Data, []byte{0x22, 0x08}) {
+		t.Errorf("Wrong memory. Got %s % x, expected 0x202 22 08.", memory.Address, memory.Data)
+	}
+	c.request("continue", map[string]int{"threadId": dapThreadID}, nil)
+	c.event("terminated", nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestDAPNext(t *testing.T) {
+	// the breakpoint on the label moves to the first instruction after it
+	c, dir := launchTestDAP(t, 3, 6)
+	defer os.RemoveAll(dir)
+	c.stop("breakpoint")
+	c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]string{"path": filepath.Join(dir, "main.asm")},
+		"breakpoints": []map[string]int{},
+	}, nil)
+	c.request("next", map[string]int{"threadId": dapThreadID}, nil)
+	c.stop("step")
+	if frames := c.frames(); frames != "start:main.asm:4" {
+		t.Errorf("Wrong stack trace after next. Got %s.", frames)
+	}
+	if v0 := c.register("V0"); v0 != "0x06" {
+		t.Errorf("Subroutine not run. Got V0 %s, expected %s.", v0, "0x06")
+	}
+	c.disconnect()
+}
+
+func TestDAPBreakpointInSubroutine(t *testing.T) {
+	c, dir := launchTestDAP(t, 3, 6)
+	defer os.RemoveAll(dir)
+	c.stop("breakpoint")
+	c.request("next", map[string]int{"threadId": dapThreadID}, nil)
+	c.stop("breakpoint")
+	if frames := c.frames(); frames != "sub:main.asm:7 start:main.asm:3" {
+		t.Errorf("Wrong stack trace. Got %s.", frames)
+	}
+	c.disconnect()
+}
+
+func TestDAPMessageFraming(t *testing.T) {
+	var buf bytes.Buffer
+	writeDAPMessage(&buf, map[string]int{"seq": 1})
+	writeDAPMessage(&buf, map[string]int{"seq": 2})
+	in := bufio.NewReader(&buf)
+	for _, expected := range []string{`{"seq":1}`, `{"seq":2}`} {
+		data, err := readDAPMessage(in)
+		if err != nil || string(data) != expected {
+			t.Errorf("Wrong message. Got %s (%v), expected %s.", data, err, expected)
+		}
+	}
+	if _, err := readDAPMessage(bufio.NewReader(strings.NewReader("Content-Type: x\r\n\r\n{}"))); err == nil {
+		t.Error("No error without Content-Length.")
+	}
+}
+
+func TestDAPReadMemoryRange(t *testing.T) {
+	emu := newGo8(nullSound{}, nullGraphics{}, Quirks{}, nil)
+	emu.memory[0] = 0xAA
+	emu.memory[memorySize-1] = 0xBB
+	dap := newDAPServer(emu)
+	tests := []struct {
+		name       string
+		reference  string
+		offset     int
+		count      int
+		address    string
+		data       string
+		unreadable int
+	}{
+		{"inside", "0x0", 0, 2, "0x0", "aa00", 0},
+		{"negative offset", "0x0", -4, 6, "0x0", "aa00", 4},
+		{"before memory", "0x0", -10, 4, "0x0", "", 4},
+		{"negative base", "-16", 2, 4, "0x0", "", 4},
+		{"past the end", "0xFFFF", 0, 4, "0xFFFF", "bb", 3},
+		{"after memory", "0x10000", 10, 4, "0x10000", "", 4},
+		{"negative count", "0x0", 0, -4, "0x0", "", 0},
+	}
+	for _, test := range tests {
+		arguments, _ := json.Marshal(map[string]interface{}{
+			"memoryReference": test.reference, "offset": test.offset, "count": test.count,
+		})
+		result, err := dap.readMemory(arguments)
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %v", test.name, err)
+			continue
+		}
+		body := result.(map[string]interface{})
+		data, _ := base64.StdEncoding.DecodeString(body["data"].(string))
+		if body["address"] != test.address || fmt.Sprintf("%x", data) != test.data || body["unreadableBytes"] != test.unreadable {
+			t.Errorf("%s: Wrong memory. Got %v %x %v, expected %s %s %d.", test.name,
+				body["address"], data, body["unreadableBytes"], test.address, test.data, test.unreadable)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dumpWidth = 16
+	listLen   = 8
+)
+
+var errQuit = errors.New("quit")
+
+var debuggerHelp = `Commands:
+  s, step [N]          execute N instructions (default 1)
+  c, continue          run until a breakpoint
+  b, break [ADDR]      set a breakpoint at ADDR, or list breakpoints
+  bo, breakop PATTERN  break on opcodes matching PATTERN, ? matches any digit (e.g. D??0)
+  d, delete ADDR|PATTERN
+                       remove a breakpoint
+  r, regs              print registers, stack and timers
+  m, mem ADDR [LEN]    hex dump LEN bytes of memory (default 64)
+  l, list [ADDR]       disassemble around ADDR (default PC)
+  p, poke VX|I|PC|ADDR VALUE...
+                       write a register, the index, the PC or memory
+  q, quit              exit the emulator
+An empty line repeats the last command.`
+
+// debugFrontend - a debugger driving the emulator through beforeCycle
+type debugFrontend interface {
+	beforeCycle() error
+	// report - pauses on an instruction that failed
+	report(err error) error
+}
+
+// debugger - command line debugger, runs before every instruction
+type debugger struct {
+	emu         *Go8
+	lines       <-chan string
+	out         io.Writer
+	breakpoints map[uint16]bool
+	patterns    []string
+	// instructions left to execute before pausing, -1 to run until a
+	// breakpoint. Starts at 0 so the program is paused before it runs.
+	steps int
+	last  string
+	// machine state when an instruction failed, resuming is refused
+	// until it changes as the instruction would only fail again
+	faultState []byte
+}
+
+func newDebugger(emu *Go8, lines <-chan string, out io.Writer) *debugger {
+	return &debugger{
+		emu:         emu,
+		lines:       lines,
+		out:         out,
+		breakpoints: map[uint16]bool{},
+	}
+}
+
+// readLines - sends the lines read from r, closes the channel at EOF
+func readLines(r io.Reader) <-chan string {
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	return lines
+}
+
+// beforeCycle - pauses before the instruction at pc if a step count ran
+// out or a breakpoint was hit, then runs commands until execution
+// resumes. The display keeps updating while paused.
+func (dbg *debugger) beforeCycle() error {
+	emu := dbg.emu
+	opcode := emu.getOpcode()
+	switch {
+	case dbg.steps > 0:
+		dbg.steps--
+		return nil
+	case dbg.steps == 0:
+	case dbg.breakpoints[emu.pc]:
+		fmt.Fprintf(dbg.out, "breakpoint at %03X\n", emu.pc)
+	case dbg.matchPattern(opcode) != "":
+		fmt.Fprintf(dbg.out, "opcode %04X matches %s\n", opcode, dbg.matchPattern(opcode))
+	default:
+		return nil
+	}
+	return dbg.pause()
+}
+
+// report - pauses after an instruction failed with err. The PC is still on
+// the instruction, so it runs again on resuming.
+func (dbg *debugger) report(err error) error {
+	fmt.Fprintln(dbg.out, err)
+	fmt.Fprintln(dbg.out, "resuming runs this instruction again, poke the PC, registers or memory first")
+	dbg.faultState = dbg.emu.encodeState()
+	if err := dbg.pause(); err != nil {
+		return err
+	}
+	// unlike a pause in beforeCycle, the instruction at the PC has yet to
+	// reach beforeCycle, so a step has to let it through
+	if dbg.steps >= 0 {
+		dbg.steps++
+	}
+	return nil
+}
+
+// canResume - refuses to resume while the machine is as it was when an
+// instruction failed
+func (dbg *debugger) canResume() bool {
+	if dbg.faultState != nil && bytes.Equal(dbg.emu.encodeState(), dbg.faultState) {
+		fmt.Fprintf(dbg.out, "the instruction at %03X would fail again, poke the PC, registers or memory first\n", dbg.emu.pc)
+		return false
+	}
+	dbg.faultState = nil
+	return true
+}
+
+func (dbg *debugger) pause() error {
+	dbg.list(dbg.emu.pc, 1)
+	fmt.Fprint(dbg.out, "> ")
+	frame := time.NewTicker(time.Second / 60)
+	defer frame.Stop()
+	for {
+		select {
+		case line, ok := <-dbg.lines:
+			if !ok {
+				return errQuit
+			}
+			if strings.TrimSpace(line) == "" {
+				line = dbg.last
+			}
+			dbg.last = line
+			resume, err := dbg.command(line)
+			if err != nil {
+				return err
+			}
+			if resume {
+				return nil
+			}
+			fmt.Fprint(dbg.out, "> ")
+		case <-frame.C:
+			if dbg.emu.graphics != nil {
+				dbg.emu.updateWindow()
+				if dbg.emu.graphics.closed() {
+					return errQuit
+				}
+			}
+		}
+	}
+}
+
+// command - runs a command, returns true if execution should resume
+func (dbg *debugger) command(line string) (bool, error) {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return false, nil
+	}
+	emu := dbg.emu
+	switch args[0] {
+	case "s", "step":
+		if !dbg.canResume() {
+			return false, nil
+		}
+		n := 1
+		if len(args) > 1 {
+			value, err := strconv.Atoi(args[1])
+			if err != nil || value < 1 {
+				fmt.Fprintf(dbg.out, "invalid step count %s\n", args[1])
+				return false, nil
+			}
+			n = value
+		}
+		// this instruction runs now, the rest count down in beforeCycle
+		dbg.steps = n - 1
+		return true, nil
+	case "c", "continue":
+		if !dbg.canResume() {
+			return false, nil
+		}
+		dbg.steps = -1
+		return true, nil
+	case "b", "break":
+		if len(args) == 1 {
+			for addr := range dbg.breakpoints {
+				fmt.Fprintf(dbg.out, "%03X\n", addr)
+			}
+			for _, pattern := range dbg.patterns {
+				fmt.Fprintln(dbg.out, pattern)
+			}
+			return false, nil
+		}
+		addr, ok := dbg.parseNum(args[1], 0xFFFF)
+		if ok {
+			dbg.breakpoints[addr] = true
+		}
+	case "bo", "breakop":
+		if len(args) != 2 || !validPattern(args[1]) {
+			fmt.Fprintln(dbg.out, "pattern must be 4 hex digits or ?")
+			return false, nil
+		}
+		dbg.patterns = append(dbg.patterns, strings.ToUpper(args[1]))
+	case "d", "delete":
+		if len(args) != 2 {
+			fmt.Fprintln(dbg.out, "usage: delete ADDR|PATTERN")
+			return false, nil
+		}
+		dbg.delete(args[1])
+	case "r", "regs":
+		printRegs(dbg.out, dbg.emu)
+	case "m", "mem":
+		if len(args) < 2 {
+			fmt.Fprintln(dbg.out, "usage: mem ADDR [LEN]")
+			return false, nil
+		}
+		addr, ok := dbg.parseNum(args[1], 0xFFFF)
+		n := uint16(64)
+		if ok && len(args) > 2 {
+			n, ok = dbg.parseNum(args[2], 0xFFFF)
+		}
+		if ok {
+			dbg.dump(addr, int(n))
+		}
+	case "l", "list":
+		addr := emu.pc
+		ok := true
+		if len(args) > 1 {
+			addr, ok = dbg.parseNum(args[1], 0xFFFF)
+		}
+		if ok {
+			dbg.list(addr, listLen)
+		}
+	case "p", "poke":
+		if len(args) < 3 {
+			fmt.Fprintln(dbg.out, "usage: poke VX|I|PC|ADDR VALUE...")
+			return false, nil
+		}
+		dbg.poke(args[1], args[2:])
+	case "q", "quit":
+		return false, errQuit
+	case "h", "help":
+		fmt.Fprintln(dbg.out, debuggerHelp)
+	default:
+		fmt.Fprintf(dbg.out, "unknown command %s, type help for a list\n", args[0])
+	}
+	return false, nil
+}
+
+// parseNum - parses a hex number, with or without 0x
+func (dbg *debugger) parseNum(text string, max uint64) (uint16, bool) {
+	value, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(text), "0x"), 16, 64)
+	if err != nil || value > max {
+		fmt.Fprintf(dbg.out, "invalid value %s\n", text)
+		return 0, false
+	}
+	return uint16(value), true
+}
+
+func validPattern(pattern string) bool {
+	if len(pattern) != 4 {
+		return false
+	}
+	for _, c := range strings.ToUpper(pattern) {
+		if !(c == '?' || c >= '0' && c <= '9' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// matchPattern - the first opcode breakpoint opcode matches, if any
+func (dbg *debugger) matchPattern(opcode uint16) string {
+	hex := fmt.Sprintf("%04X", opcode)
+	for _, pattern := range dbg.patterns {
+		match := true
+		for i := range pattern {
+			if pattern[i] != '?' && pattern[i] != hex[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return pattern
+		}
+	}
+	return ""
+}
+
+func (dbg *debugger) delete(arg string) {
+	for i, pattern := range dbg.patterns {
+		if strings.EqualFold(pattern, arg) {
+			dbg.patterns = append(dbg.patterns[:i], dbg.patterns[i+1:]...)
+			return
+		}
+	}
+	if addr, ok := dbg.parseNum(arg, 0xFFFF); ok {
+		delete(dbg.breakpoints, addr)
+	}
+}
+
+// printRegs - prints the registers, timers and stack of emu
+func printRegs(w io.Writer, emu *Go8) {
+	for i, v := range emu.V {
+		fmt.Fprintf(w, "V%X=%02X", i, v)
+		if i%8 == 7 {
+			fmt.Fprintln(w)
+		} else {
+			fmt.Fprint(w, " ")
+		}
+	}
+	fmt.Fprintf(w, "PC=%03X I=%03X SP=%X DT=%02X ST=%02X\n",
+		emu.pc, emu.index, emu.sp, emu.delayTimer, emu.soundTimer)
+	fmt.Fprint(w, "stack:")
+	for i := uint16(0); i < emu.sp && int(i) < len(emu.stack); i++ {
+		fmt.Fprintf(w, " %03X", emu.stack[i])
+	}
+	fmt.Fprintln(w)
+}
+
+func (dbg *debugger) dump(addr uint16, n int) {
+	for i := 0; i < n; i += dumpWidth {
+		start := int(addr) + i
+		if start >= memorySize {
+			return
+		}
+		fmt.Fprintf(dbg.out, "%04X:", start)
+		for j := start; j < start+dumpWidth && j < int(addr)+n && j < memorySize; j++ {
+			fmt.Fprintf(dbg.out, " %02X", dbg.emu.memory[j])
+		}
+		fmt.Fprintln(dbg.out)
+	}
+}
+
+// list - disassembles n instructions from addr, marking the one at pc.
+// Starting a little before pc gives some context.
+func (dbg *debugger) list(addr uint16, n int) {
+	emu := dbg.emu
+	if n > 1 && addr >= 4 {
+		addr -= 4
+	}
+	for i := 0; i < n && int(addr)+1 < memorySize; i++ {
+		inst := Decode(emu.opcodeAt(addr))
+		marker := " "
+		if addr == emu.pc {
+			marker = ">"
+		}
+		text := fmt.Sprintf("db 0x%02X, 0x%02X", emu.memory[addr], emu.memory[addr+1])
+		if inst.Valid() {
+			text = formatInstruction(inst, emu.opcodeAt(addr+2))
+		}
+		fmt.Fprintf(dbg.out, "%s %03X: %04X  %s\n", marker, addr, inst.Opcode, text)
+		addr += uint16(inst.Length)
+	}
+}
+
+func (dbg *debugger) poke(target string, values []string) {
+	emu := dbg.emu
+	switch {
+	case isRegister(target):
+		if value, ok := dbg.parseNum(values[0], 0xFF); ok {
+			emu.V[registerNum(target)] = uint8(value)
+		}
+	case strings.EqualFold(target, "I"):
+		if value, ok := dbg.parseNum(values[0], 0xFFFF); ok {
+			emu.index = value
+		}
+	case strings.EqualFold(target, "PC"):
+		if value, ok := dbg.parseNum(values[0], 0xFFFF); ok {
+			emu.pc = value
+		}
+	default:
+		addr, ok := dbg.parseNum(target, 0xFFFF)
+		if !ok {
+			return
+		}
+		for i, text := range values {
+			value, ok := dbg.parseNum(text, 0xFF)
+			if !ok || int(addr)+i >= memorySize {
+				return
+			}
+			emu.memory[int(addr)+i] = uint8(value)
+		}
+	}
+}
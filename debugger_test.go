@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// newTestDebugger - a debugger reading the given commands, quitting once
+// they run out
+func newTestDebugger(go8 *Go8, commands ...string) (*debugger, *bytes.Buffer) {
+	lines := make(chan string, len(commands))
+	for _, command := range commands {
+		lines <- command
+	}
+	close(lines)
+	out := &bytes.Buffer{}
+	dbg := newDebugger(go8, lines, out)
+	go8.beforeCycle = dbg.beforeCycle
+	return dbg, out
+}
+
+func TestDebuggerBreak(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands []string
+		pc       uint16
+		v0       uint8
+	}{
+		{"paused at start", nil, 0x200, 0},
+		{"step", []string{"step"}, 0x202, 1},
+		{"step n", []string{"s 3"}, 0x206, 3},
+		{"repeat step", []string{"s 2", ""}, 0x208, 4},
+		{"breakpoint", []string{"b 206", "c"}, 0x206, 3},
+		{"deleted breakpoint", []string{"b 204", "b 206", "d 204", "c"}, 0x206, 3},
+		{"opcode pattern", []string{"bo d??1", "c"}, 0x208, 4},
+		{"deleted opcode pattern", []string{"bo D??1", "b 20A", "d D??1", "c"}, 0x20A, 4},
+	}
+	program := []uint8{
+		0x70, 0x01, // 200: V0 += 1
+		0x70, 0x01,
+		0x70, 0x01,
+		0x70, 0x01,
+		0xD0, 0x01, // 208: draw
+		0x12, 0x00, // 20A: loop
+	}
+	for _, test := range tests {
+		go8 := newGo8(&testSound{}, &testGraphics{}, Quirks{}, nil)
+		go8.cyclesPerFrame = 100
+		copy(go8.memory[0x200:], program)
+		newTestDebugger(go8, test.commands...)
+		if err := go8.RunFrame(); err != errQuit {
+			t.Errorf("%s: Wrong error. Got %v, expected %v.", test.name, err, errQuit)
+		}
+		if go8.pc != test.pc || go8.V[0] != test.v0 {
+			t.Errorf("%s: Wrong pause. Got pc %x V0 %x, expected pc %x V0 %x.",
+				test.name, go8.pc, go8.V[0], test.pc, test.v0)
+		}
+	}
+}
+
+func TestDebuggerPoke(t *testing.T) {
+	go8 := Go8{}
+	go8.initialize()
+	dbg, out := newTestDebugger(&go8)
+	for _, command := range []string{"p V3 42", "poke I 0x300", "p 300 1 2 FF", "p VA 100", "p 400 zz", "p pc 2F0"} {
+		dbg.command(command)
+	}
+	if go8.V[3] != 0x42 {
+		t.Errorf("Wrong register. Got %x, expected %x.", go8.V[3], 0x42)
+	}
+	if go8.V[0xA] != 0 {
+		t.Errorf("Register overflowed. Got %x, expected %x.", go8.V[0xA], 0)
+	}
+	if go8.index != 0x300 {
+		t.Errorf("Wrong index. Got %x, expected %x.", go8.index, 0x300)
+	}
+	checkPc(0x2F0, go8.pc, t)
+	if mem := go8.memory[0x300:0x304]; !bytes.Equal(mem, []uint8{0x01, 0x02, 0xFF, 0x00}) {
+		t.Errorf("Wrong memory. Got % x, expected % x.", mem, []uint8{0x01, 0x02, 0xFF, 0x00})
+	}
+	if errors := strings.Count(out.String(), "invalid value"); errors != 2 {
+		t.Errorf("Wrong number of errors. Got %d, expected %d.\n%s", errors, 2, out)
+	}
+}
+
+func TestDebuggerResumeAfterFault(t *testing.T) {
+	go8 := newGo8(&testSound{}, &testGraphics{}, Quirks{}, nil)
+	copy(go8.memory[0x200:], []uint8{
+		0x00, 0xEE, // 200: return without a call
+		0x60, 0x07, // 202: V0 = 7
+		0x12, 0x04, // 204: loop
+	})
+	dbg, out := newTestDebugger(go8, "c", "c", "s", "p PC 202", "s")
+	err := go8.RunFrame()
+	if _, ok := err.(*ExecError); !ok {
+		t.Fatalf("Wrong error. Got %v, expected an ExecError.", err)
+	}
+	if err := dbg.report(err); err != nil {
+		t.Fatalf("Not resumed after poking the PC. Got %v.", err)
+	}
+	if refused := strings.Count(out.String(), "would fail again"); refused != 2 {
+		t.Errorf("Wrong number of refused resumes. Got %d, expected 2.\n%s", refused, out)
+	}
+	if !strings.Contains(out.String(), "runs this instruction again") {
+		t.Errorf("Fault not explained. Got:\n%s", out)
+	}
+	if err := go8.RunFrame(); err != errQuit {
+		t.Errorf("Wrong error. Got %v, expected %v.", err, errQuit)
+	}
+	if go8.pc != 0x204 || go8.V[0] != 7 {
+		t.Errorf("Wrong state after resuming. Got pc %x V0 %x, expected pc 204 V0 7.", go8.pc, go8.V[0])
+	}
+}
+
+func TestDebuggerPrint(t *testing.T) {
+	go8 := Go8{}
+	go8.initialize()
+	copy(go8.memory[0x200:], []uint8{0x60, 0x05, 0x22, 0x08, 0xF0, 0x00, 0x03, 0x00, 0x00, 0xEE})
+	go8.pc = 0x204
+	go8.V[0xB] = 0x7F
+	go8.stack[0] = 0x202
+	go8.sp = 1
+	go8.delayTimer = 0x10
+	tests := []struct {
+		command  string
+		expected []string
+	}{
+		{"regs", []string{"VB=7F", "PC=204", "SP=1", "DT=10", "stack: 202\n"}},
+		{"m 200 18", []string{
+			"0200: 60 05 22 08 F0 00 03 00 00 EE 00 00 00 00 00 00\n",
+			"0210: 00 00 00 00 00 00 00 00\n",
+		}},
+		{"l", []string{
+			"  200: 6005  LD V0, 0x05\n",
+			"  202: 2208  CALL 0x208\n",
+			"> 204: F000  LD I, LONG 0x0300\n",
+			"  208: 00EE  RET\n",
+			"  20A: 0000  db 0x00, 0x00\n",
+		}},
+	}
+	for _, test := range tests {
+		dbg, out := newTestDebugger(&go8)
+		dbg.command(test.command)
+		for _, expected := range test.expected {
+			if !strings.Contains(out.String(), expected) {
+				t.Errorf("%s: missing %q in output:\n%s", test.command, expected, out)
+			}
+		}
+	}
+}
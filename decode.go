@@ -0,0 +1,163 @@
+package main
+
+// Variant - the instruction set an instruction was introduced in
+type Variant int
+
+// Variant values
+const (
+	Invalid Variant = iota
+	CHIP8
+	SCHIP
+	XOCHIP
+)
+
+var variantNames = []string{
+	Invalid: "invalid",
+	CHIP8:   "CHIP-8",
+	SCHIP:   "SUPER-CHIP",
+	XOCHIP:  "XO-CHIP",
+}
+
+func (variant Variant) String() string {
+	if variant < 0 || int(variant) >= len(variantNames) {
+		return "invalid"
+	}
+	return variantNames[variant]
+}
+
+// Instruction - a decoded opcode. All operand fields are extracted from
+// every opcode, Operands tells which of them the instruction uses.
+type Instruction struct {
+	Opcode   uint16
+	Mnemonic string
+	// operand syntax, e.g. "VX, NN", see opTable
+	Operands string
+	X        uint8
+	Y        uint8
+	N        uint8
+	NN       uint8
+	NNN      uint16
+	// in bytes, 4 for the XO-CHIP long index load
+	Length  int
+	Variant Variant
+	exec    func(*Go8)
+}
+
+// Valid - false if the opcode is not an instruction in any variant
+func (inst Instruction) Valid() bool {
+	return inst.Variant != Invalid
+}
+
+// opcodeSpec - an instruction encoding. An opcode is an instance of the
+// instruction if opcode & mask == pattern. In operands, VX, VY, X, N, NN
+// and NNN stand for the opcode fields, NNNN for the word following the
+// opcode, and anything else is literal.
+type opcodeSpec struct {
+	pattern  uint16
+	mask     uint16
+	mnemonic string
+	operands string
+	variant  Variant
+	exec     func(*Go8)
+}
+
+var opTable = []opcodeSpec{
+	{0x00C0, 0xFFF0, "SCD", "N", SCHIP, (*Go8).scrollDown},
+	{0x00D0, 0xFFF0, "SCU", "N", XOCHIP, (*Go8).scrollUp},
+	{0x00E0, 0xFFFF, "CLS", "", CHIP8, (*Go8).clearScreen},
+	{0x00EE, 0xFFFF, "RET", "", CHIP8, (*Go8).ret},
+	{0x00FB, 0xFFFF, "SCR", "", SCHIP, (*Go8).scrollRight},
+	{0x00FC, 0xFFFF, "SCL", "", SCHIP, (*Go8).scrollLeft},
+	{0x00FD, 0xFFFF, "EXIT", "", SCHIP, (*Go8).exit},
+	{0x00FE, 0xFFFF, "LOW", "", SCHIP, (*Go8).lowRes},
+	{0x00FF, 0xFFFF, "HIGH", "", SCHIP, (*Go8).highRes},
+	{0x1000, 0xF000, "JP", "NNN", CHIP8, (*Go8).jump},
+	{0x2000, 0xF000, "CALL", "NNN", CHIP8, (*Go8).callSubroutine},
+	{0x3000, 0xF000, "SE", "VX, NN", CHIP8, (*Go8).ifEqual},
+	{0x4000, 0xF000, "SNE", "VX, NN", CHIP8, (*Go8).ifNotEqual},
+	{0x5000, 0xF00F, "SE", "VX, VY", CHIP8, (*Go8).ifEqualReg},
+	{0x5002, 0xF00F, "SAVE", "VX, VY", XOCHIP, (*Go8).saveRange},
+	{0x5003, 0xF00F, "LOAD", "VX, VY", XOCHIP, (*Go8).loadRange},
+	{0x6000, 0xF000, "LD", "VX, NN", CHIP8, (*Go8).setConstant},
+	{0x7000, 0xF000, "ADD", "VX, NN", CHIP8, (*Go8).addConstant},
+	{0x8000, 0xF00F, "LD", "VX, VY", CHIP8, (*Go8).setRegs},
+	{0x8001, 0xF00F, "OR", "VX, VY", CHIP8, (*Go8).orRegs},
+	{0x8002, 0xF00F, "AND", "VX, VY", CHIP8, (*Go8).andRegs},
+	{0x8003, 0xF00F, "XOR", "VX, VY", CHIP8, (*Go8).xorRegs},
+	{0x8004, 0xF00F, "ADD", "VX, VY", CHIP8, (*Go8).addRegs},
+	{0x8005, 0xF00F, "SUB", "VX, VY", CHIP8, (*Go8).subRegs},
+	{0x8006, 0xF00F, "SHR", "VX, VY", CHIP8, (*Go8).rshift},
+	{0x8007, 0xF00F, "SUBN", "VX, VY", CHIP8, (*Go8).subRegsReverse},
+	{0x800E, 0xF00F, "SHL", "VX, VY", CHIP8, (*Go8).lshift},
+	{0x9000, 0xF00F, "SNE", "VX, VY", CHIP8, (*Go8).ifNotEqualReg},
+	{0xA000, 0xF000, "LD", "I, NNN", CHIP8, (*Go8).setIndex},
+	{0xB000, 0xF000, "JP", "V0, NNN", CHIP8, (*Go8).addJump},
+	{0xC000, 0xF000, "RND", "VX, NN", CHIP8, (*Go8).rand},
+	{0xD000, 0xF000, "DRW", "VX, VY, N", CHIP8, (*Go8).draw},
+	{0xE09E, 0xF0FF, "SKP", "VX", CHIP8, (*Go8).ifPressed},
+	{0xE0A1, 0xF0FF, "SKNP", "VX", CHIP8, (*Go8).ifNotPressed},
+	{0xF000, 0xFFFF, "LD", "I, LONG NNNN", XOCHIP, (*Go8).longIndex},
+	{0xF001, 0xF0FF, "PLANE", "X", XOCHIP, (*Go8).selectPlane},
+	{0xF002, 0xFFFF, "AUDIO", "", XOCHIP, (*Go8).loadPattern},
+	{0xF007, 0xF0FF, "LD", "VX, DT", CHIP8, (*Go8).storeDelay},
+	{0xF00A, 0xF0FF, "LD", "VX, K", CHIP8, (*Go8).getKey},
+	{0xF015, 0xF0FF, "LD", "DT, VX", CHIP8, (*Go8).setDelay},
+	{0xF018, 0xF0FF, "LD", "ST, VX", CHIP8, (*Go8).setSound},
+	{0xF01E, 0xF0FF, "ADD", "I, VX", CHIP8, (*Go8).addToIndex},
+	{0xF029, 0xF0FF, "LD", "F, VX", CHIP8, (*Go8).getSprite},
+	{0xF030, 0xF0FF, "LD", "HF, VX", SCHIP, (*Go8).getBigSprite},
+	{0xF033, 0xF0FF, "LD", "B, VX", CHIP8, (*Go8).storeBCD},
+	{0xF03A, 0xF0FF, "PITCH", "VX", XOCHIP, (*Go8).setPitch},
+	{0xF055, 0xF0FF, "LD", "[I], VX", CHIP8, (*Go8).regDump},
+	{0xF065, 0xF0FF, "LD", "VX, [I]", CHIP8, (*Go8).regLoad},
+	{0xF075, 0xF0FF, "LD", "R, VX", SCHIP, (*Go8).saveFlags},
+	{0xF085, 0xF0FF, "LD", "VX, R", SCHIP, (*Go8).loadFlags},
+}
+
+// decodeTable - index+1 of the opTable entry for every opcode, 0 if invalid
+var decodeTable [0x10000]uint8
+
+func init() {
+	for i, spec := range opTable {
+		for opcode := 0; opcode < len(decodeTable); opcode++ {
+			if uint16(opcode)&spec.mask == spec.pattern {
+				decodeTable[opcode] = uint8(i + 1)
+			}
+		}
+	}
+}
+
+// Decode - decodes opcode. Invalid opcodes decode to an instruction with
+// Variant Invalid and an empty Mnemonic.
+func Decode(opcode uint16) Instruction {
+	inst := Instruction{
+		Opcode: opcode,
+		X:      uint8(opcode & 0x0F00 >> 8),
+		Y:      uint8(opcode & 0x00F0 >> 4),
+		N:      uint8(opcode & 0x000F),
+		NN:     uint8(opcode & 0x00FF),
+		NNN:    opcode & 0x0FFF,
+		Length: 2,
+	}
+	i := decodeTable[opcode]
+	if i == 0 {
+		return inst
+	}
+	spec := opTable[i-1]
+	inst.Mnemonic = spec.mnemonic
+	inst.Operands = spec.operands
+	inst.Variant = spec.variant
+	inst.exec = spec.exec
+	inst.Length = instructionLength(opcode)
+	return inst
+}
+
+// instructionLength - length in bytes of the instruction starting with
+// opcode, kept apart from Decode so handlers can use it without
+// referring back to opTable
+func instructionLength(opcode uint16) int {
+	if opcode == 0xF000 {
+		return 4
+	}
+	return 2
+}
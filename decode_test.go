@@ -0,0 +1,117 @@
+package main
+
+import "testing"
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		opcode   uint16
+		mnemonic string
+		operands string
+		variant  Variant
+	}{
+		{0x00C4, "SCD", "N", SCHIP},
+		{0x00D4, "SCU", "N", XOCHIP},
+		{0x00E0, "CLS", "", CHIP8},
+		{0x00EE, "RET", "", CHIP8},
+		{0x00FB, "SCR", "", SCHIP},
+		{0x00FC, "SCL", "", SCHIP},
+		{0x00FD, "EXIT", "", SCHIP},
+		{0x00FE, "LOW", "", SCHIP},
+		{0x00FF, "HIGH", "", SCHIP},
+		{0x1234, "JP", "NNN", CHIP8},
+		{0x2234, "CALL", "NNN", CHIP8},
+		{0x3234, "SE", "VX, NN", CHIP8},
+		{0x4234, "SNE", "VX, NN", CHIP8},
+		{0x5230, "SE", "VX, VY", CHIP8},
+		{0x5232, "SAVE", "VX, VY", XOCHIP},
+		{0x5233, "LOAD", "VX, VY", XOCHIP},
+		{0x6234, "LD", "VX, NN", CHIP8},
+		{0x7234, "ADD", "VX, NN", CHIP8},
+		{0x8230, "LD", "VX, VY", CHIP8},
+		{0x8231, "OR", "VX, VY", CHIP8},
+		{0x8232, "AND", "VX, VY", CHIP8},
+		{0x8233, "XOR", "VX, VY", CHIP8},
+		{0x8234, "ADD", "VX, VY", CHIP8},
+		{0x8235, "SUB", "VX, VY", CHIP8},
+		{0x8236, "SHR", "VX, VY", CHIP8},
+		{0x8237, "SUBN", "VX, VY", CHIP8},
+		{0x823E, "SHL", "VX, VY", CHIP8},
+		{0x9230, "SNE", "VX, VY", CHIP8},
+		{0xA234, "LD", "I, NNN", CHIP8},
+		{0xB234, "JP", "V0, NNN", CHIP8},
+		{0xC234, "RND", "VX, NN", CHIP8},
+		{0xD234, "DRW", "VX, VY, N", CHIP8},
+		{0xE29E, "SKP", "VX", CHIP8},
+		{0xE2A1, "SKNP", "VX", CHIP8},
+		{0xF000, "LD", "I, LONG NNNN", XOCHIP},
+		{0xF201, "PLANE", "X", XOCHIP},
+		{0xF002, "AUDIO", "", XOCHIP},
+		{0xF207, "LD", "VX, DT", CHIP8},
+		{0xF20A, "LD", "VX, K", CHIP8},
+		{0xF215, "LD", "DT, VX", CHIP8},
+		{0xF218, "LD", "ST, VX", CHIP8},
+		{0xF21E, "ADD", "I, VX", CHIP8},
+		{0xF229, "LD", "F, VX", CHIP8},
+		{0xF230, "LD", "HF, VX", SCHIP},
+		{0xF233, "LD", "B, VX", CHIP8},
+		{0xF23A, "PITCH", "VX", XOCHIP},
+		{0xF255, "LD", "[I], VX", CHIP8},
+		{0xF265, "LD", "VX, [I]", CHIP8},
+		{0xF275, "LD", "R, VX", SCHIP},
+		{0xF285, "LD", "VX, R", SCHIP},
+		// invalid
+		{0x0000, "", "", Invalid},
+		{0x0123, "", "", Invalid},
+		{0x01E0, "", "", Invalid},
+		{0x5231, "", "", Invalid},
+		{0x8008, "", "", Invalid},
+		{0x800F, "", "", Invalid},
+		{0x9231, "", "", Invalid},
+		{0xE2FF, "", "", Invalid},
+		{0xF100, "", "", Invalid},
+		{0xF102, "", "", Invalid},
+		{0xF2FF, "", "", Invalid},
+	}
+	for _, test := range tests {
+		inst := Decode(test.opcode)
+		if inst.Mnemonic != test.mnemonic || inst.Operands != test.operands || inst.Variant != test.variant {
+			t.Errorf("Wrong decoding for %04x. Got %s %q (%v), expected %s %q (%v).",
+				test.opcode,
+				inst.Mnemonic, inst.Operands, inst.Variant,
+				test.mnemonic, test.operands, test.variant)
+		}
+		if inst.Valid() != (test.variant != Invalid) {
+			t.Errorf("Wrong validity for %04x. Got %v.", test.opcode, inst.Valid())
+		}
+	}
+}
+
+func TestDecodeFields(t *testing.T) {
+	inst := Decode(0xD12A)
+	if inst.X != 0x1 || inst.Y != 0x2 || inst.N != 0xA || inst.NN != 0x2A || inst.NNN != 0x12A {
+		t.Errorf("Wrong operand fields. Got %+v.", inst)
+	}
+	if inst.Length != 2 {
+		t.Errorf("Wrong length. Got %d, expected %d.", inst.Length, 2)
+	}
+	if inst := Decode(0xF000); inst.Length != 4 {
+		t.Errorf("Wrong length for long index load. Got %d, expected %d.", inst.Length, 4)
+	}
+}
+
+func TestDecodeUnambiguous(t *testing.T) {
+	for opcode := 0; opcode <= 0xFFFF; opcode++ {
+		matches := 0
+		for _, spec := range opTable {
+			if uint16(opcode)&spec.mask == spec.pattern {
+				matches++
+			}
+		}
+		if matches > 1 {
+			t.Errorf("Opcode %04x matches %d instructions.", opcode, matches)
+		}
+		if valid := Decode(uint16(opcode)).Valid(); valid != (matches == 1) {
+			t.Errorf("Wrong validity for %04x. Got %v.", opcode, valid)
+		}
+	}
+}
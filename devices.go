@@ -0,0 +1,22 @@
+package main
+
+// The devices the emulator core draws, plays sound and reads keys with.
+// Each frontend has its own: pixel and beep on the desktop, the terminal,
+// a canvas and WebAudio in the browser and null devices when headless.
+
+// GraphicsDevice - a generic graphics device interface
+type GraphicsDevice interface {
+	// gfx is row-major with the given width and height, which change
+	// when the program switches between lores and hires mode
+	updateWindow(gfx []uint8, w, h int)
+	closed() bool
+	pressed(key int) bool
+}
+
+// SoundDevice - a generic sound device interface
+type SoundDevice interface {
+	// start - plays gen in a loop until stop is called, replacing the
+	// sound playing
+	start(gen generator)
+	stop()
+}
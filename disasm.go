@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	// data regions up to this size referenced by LD I are shown as sprites
+	maxSpriteLen = 32
+	dataPerLine  = 8
+)
+
+// disassembler - separates the code in a ROM from its data by following
+// every path through the program from startPc
+type disassembler struct {
+	rom []byte
+	// instruction length at each instruction start, 0 elsewhere
+	code []int
+	// labels by address
+	labels map[uint16]string
+}
+
+func disassemble(rom []byte) string {
+	dis := &disassembler{
+		rom:    rom,
+		code:   make([]int, len(rom)),
+		labels: map[uint16]string{},
+	}
+	dis.trace(startPc)
+	return dis.String()
+}
+
+func (dis *disassembler) inROM(addr uint16) bool {
+	return int(addr) >= startPc && int(addr)-startPc < len(dis.rom)
+}
+
+func (dis *disassembler) opcodeAt(addr uint16) uint16 {
+	i := int(addr) - startPc
+	if i+1 >= len(dis.rom) {
+		return 0
+	}
+	return uint16(dis.rom[i])<<8 | uint16(dis.rom[i+1])
+}
+
+func (dis *disassembler) label(addr uint16, prefix string) {
+	if !dis.inROM(addr) {
+		return
+	}
+	if _, ok := dis.labels[addr]; !ok || prefix == "sub" {
+		dis.labels[addr] = fmt.Sprintf("%s_%03x", prefix, addr)
+	}
+}
+
+// trace - marks everything reachable from addr as code
+func (dis *disassembler) trace(addr uint16) {
+	work := []uint16{addr}
+	for len(work) > 0 {
+		addr, work = work[len(work)-1], work[:len(work)-1]
+		for dis.inROM(addr) && dis.code[int(addr)-startPc] == 0 {
+			inst := Decode(dis.opcodeAt(addr))
+			if !inst.Valid() || int(addr)-startPc+inst.Length > len(dis.rom) {
+				break
+			}
+			dis.code[int(addr)-startPc] = inst.Length
+			next := addr + uint16(inst.Length)
+			switch inst.Mnemonic {
+			case "RET", "EXIT":
+				next = 0
+			case "JP":
+				// JP V0, NNN jumps into a table at NNN
+				dis.label(inst.NNN, "label")
+				work = append(work, inst.NNN)
+				next = 0
+			case "CALL":
+				dis.label(inst.NNN, "sub")
+				work = append(work, inst.NNN)
+			case "SE", "SNE", "SKP", "SKNP":
+				work = append(work, next+uint16(instructionLength(dis.opcodeAt(next))))
+			case "LD":
+				if inst.Operands == "I, NNN" {
+					dis.label(inst.NNN, "data")
+				} else if inst.Operands == "I, LONG NNNN" {
+					dis.label(dis.opcodeAt(addr+2), "data")
+				}
+			}
+			if next == 0 {
+				break
+			}
+			addr = next
+		}
+	}
+}
+
+// isCode - whether the instruction at addr can be emitted as such without
+// hiding an instruction start or label in its operand bytes
+func (dis *disassembler) isCode(addr uint16) bool {
+	n := dis.code[int(addr)-startPc]
+	if n == 0 {
+		return false
+	}
+	for i := 1; i < n; i++ {
+		a := addr + uint16(i)
+		if _, ok := dis.labels[a]; ok || dis.code[int(a)-startPc] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (dis *disassembler) String() string {
+	var out bytes.Buffer
+	out.WriteString("; disassembled by go-8\n")
+	addr := uint16(startPc)
+	for dis.inROM(addr) {
+		if label, ok := dis.labels[addr]; ok {
+			fmt.Fprintf(&out, "%s:\n", label)
+		}
+		if dis.isCode(addr) {
+			inst := Decode(dis.opcodeAt(addr))
+			fmt.Fprintf(&out, "\t%s\n", dis.format(inst, dis.opcodeAt(addr+2)))
+			addr += uint16(inst.Length)
+			continue
+		}
+		addr = dis.data(&out, addr)
+	}
+	return out.String()
+}
+
+// data - writes the data region starting at addr, returns where it ends
+func (dis *disassembler) data(out *bytes.Buffer, addr uint16) uint16 {
+	end := addr + 1
+	for dis.inROM(end) && !dis.isCode(end) {
+		if _, ok := dis.labels[end]; ok {
+			break
+		}
+		end++
+	}
+	region := dis.rom[int(addr)-startPc : int(end)-startPc]
+	label := dis.labels[addr]
+	if strings.HasPrefix(label, "data") && len(region) <= maxSpriteLen {
+		for _, b := range region {
+			fmt.Fprintf(out, "\tdb 0x%02X ; %s\n", b, spriteRow(b))
+		}
+		return end
+	}
+	for i := 0; i < len(region); i += dataPerLine {
+		line := region[i:]
+		if len(line) > dataPerLine {
+			line = line[:dataPerLine]
+		}
+		hex := make([]string, len(line))
+		for j, b := range line {
+			hex[j] = fmt.Sprintf("0x%02X", b)
+		}
+		fmt.Fprintf(out, "\tdb %s\n", strings.Join(hex, ", "))
+	}
+	return end
+}
+
+// spriteRow - draws b as a sprite line, # for set pixels
+func spriteRow(b uint8) string {
+	row := make([]byte, 8)
+	for i := range row {
+		row[i] = '.'
+		if b&(0x80>>uint(i)) != 0 {
+			row[i] = '#'
+		}
+	}
+	return string(row)
+}
+
+// format - renders inst in assembler syntax, next is the word following
+// the opcode
+func (dis *disassembler) format(inst Instruction, next uint16) string {
+	if inst.Operands == "" {
+		return inst.Mnemonic
+	}
+	operands := strings.Split(inst.Operands, ", ")
+	for i, operand := range operands {
+		switch operand {
+		case "VX":
+			operands[i] = fmt.Sprintf("V%X", inst.X)
+		case "VY":
+			operands[i] = fmt.Sprintf("V%X", inst.Y)
+		case "X":
+			operands[i] = fmt.Sprintf("%d", inst.X)
+		case "N":
+			operands[i] = fmt.Sprintf("%d", inst.N)
+		case "NN":
+			operands[i] = fmt.Sprintf("0x%02X", inst.NN)
+		case "NNN":
+			operands[i] = dis.address(inst.NNN, "0x%03X")
+		case "LONG NNNN":
+			operands[i] = "LONG " + dis.address(next, "0x%04X")
+		}
+	}
+	return inst.Mnemonic + " " + strings.Join(operands, ", ")
+}
+
+// formatInstruction - renders inst without labels
+func formatInstruction(inst Instruction, next uint16) string {
+	return (&disassembler{}).format(inst, next)
+}
+
+func (dis *disassembler) address(addr uint16, format string) string {
+	if label, ok := dis.labels[addr]; ok {
+		return label
+	}
+	return fmt.Sprintf(format, addr)
+}
+
+// disasmCommand - go-8 disasm [-o out.asm] rom.ch8
+func disasmCommand(args []string) error {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	output := flags.String("o", "", "Output file, defaults to stdout.")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: go-8 disasm [-o out.asm] rom.ch8")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	rom, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	text := disassemble(rom)
+	if *output == "" {
+		_, err = fmt.Print(text)
+		return err
+	}
+	return ioutil.WriteFile(*output, []byte(text), 0644)
+}
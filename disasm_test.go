@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+func TestDisassemble(t *testing.T) {
+	rom := []uint8{
+		0xA2, 0x0E, // 200: LD I, data_20e
+		0x22, 0x0A, // 202: CALL sub_20a
+		0x30, 0x01, // 204: SE V0, 0x01
+		0x12, 0x04, // 206: JP label_204
+		0x00, 0xFD, // 208: EXIT
+		0xD0, 0x12, // 20a: DRW V0, V1, 2
+		0x00, 0xEE, // 20c: RET
+		0x3C, 0x18, // 20e: sprite
+		0xFF, 0xFF, 0x01, // 210: unreachable
+	}
+	expected := `; disassembled by go-8
+	LD I, data_20e
+	CALL sub_20a
+label_204:
+	SE V0, 0x01
+	JP label_204
+	EXIT
+sub_20a:
+	DRW V0, V1, 2
+	RET
+data_20e:
+	db 0x3C ; ..####..
+	db 0x18 ; ...##...
+	db 0xFF ; ########
+	db 0xFF ; ########
+	db 0x01 ; .......#
+`
+	if text := disassemble(rom); text != expected {
+		t.Errorf("Wrong disassembly. Got:\n%s\nexpected:\n%s", text, expected)
+	}
+}
+
+func TestDisassembleData(t *testing.T) {
+	rom := []uint8{
+		0x12, 0x0C, // 200: JP label_20c
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0A, // 202: data
+		0xF0, 0x00, 0x02, 0x02, // 20c: LD I, LONG data_202
+		0x00, 0xFD, // 210: EXIT
+	}
+	expected := `; disassembled by go-8
+	JP label_20c
+data_202:
+	db 0x01 ; .......#
+	db 0x02 ; ......#.
+	db 0x03 ; ......##
+	db 0x04 ; .....#..
+	db 0x05 ; .....#.#
+	db 0x06 ; .....##.
+	db 0x07 ; .....###
+	db 0x08 ; ....#...
+	db 0x09 ; ....#..#
+	db 0x0A ; ....#.#.
+label_20c:
+	LD I, LONG data_202
+	EXIT
+`
+	if text := disassemble(rom); text != expected {
+		t.Errorf("Wrong disassembly. Got:\n%s\nexpected:\n%s", text, expected)
+	}
+	// unreferenced data is not drawn as a sprite
+	rom = []uint8{0x00, 0xFD, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09}
+	expected = `; disassembled by go-8
+	EXIT
+	db 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08
+	db 0x09
+`
+	if text := disassemble(rom); text != expected {
+		t.Errorf("Wrong disassembly. Got:\n%s\nexpected:\n%s", text, expected)
+	}
+}
@@ -1,28 +1,42 @@
 package main
 
 import (
-	"fmt"
 	"io/ioutil"
-	"math/rand"
+	"time"
 )
 
 const (
-	spriteWidth = 8
-	spriteMem   = 0x50
-	startPc     = 0x200
+	spriteWidth  = 8
+	spriteMem    = 0x50
+	bigSpriteMem = 0xA0
+	startPc      = 0x200
+	memorySize   = 0x10000
+	screenWidth  = 64
+	screenHeight = 32
+	hiresWidth   = 128
+	hiresHeight  = 64
+	// 300 Hz at 60 frames per second
+	defaultCyclesPerFrame = 5
+	// the delay and sound timers count down at 60 Hz
+	timerRate = 60
 )
 
 // Go8 - CHIP-8 emulator
 type Go8 struct {
 	opcode uint16
-	memory [4096]uint8
+	// 4096 bytes for CHIP-8 and SCHIP, 64 KiB for XO-CHIP
+	memory [memorySize]uint8
 	// all registers V0-VF
 	V [16]uint8
 	// index and program counter registers
 	index uint16
 	pc    uint16
-	// 64 x 32 px screen, black or white
-	gfx [64 * 32]uint8
+	// 64 x 32 px screen (128 x 64 in hires mode), each pixel is a bit
+	// mask of the XO-CHIP planes it is lit in
+	gfx   [hiresWidth * hiresHeight]uint8
+	hires bool
+	// bit mask of the planes drawing instructions operate on
+	plane uint8
 	// timers
 	delayTimer uint8
 	soundTimer uint8
@@ -32,98 +46,116 @@ type Go8 struct {
 	// keypad (input device)
 	key      [16]uint8
 	drawFlag bool
+	// set by draw when the display wait quirk is on, cleared on vblank
+	vblankWait bool
+	// set by 00FD, stops execution
+	exited bool
+	// error raised by the instruction being executed
+	err error
+	// instructions executed by RunFrame
+	cyclesPerFrame int
+	// frames per second RunFrame is called at, 0 for timerRate; the
+	// timers tick whenever timerPhase reaches it
+	frameRate  int
+	timerPhase int
+	// XO-CHIP audio pattern, loaded is set once F002 has run
+	audio       audioPattern
+	audioLoaded bool
+	// buzzer played without a pattern, not reset by initialize
+	tone tone
+	// SCHIP RPL user flags, persist across resets like the HP48 flags
+	rpl [16]uint8
+	// random source for CXNN, not reset by initialize
+	rng      Random
+	quirks   Quirks
 	sound    SoundDevice
 	graphics GraphicsDevice
+	// changes what the graphics device shows, e.g. to hide flicker
+	filter displayFilter
+	// called by RunFrame before each instruction, e.g. by the debugger
+	beforeCycle func() error
+	// supplies the keypad state of each frame instead of the graphics
+	// device, e.g. when playing a movie
+	keypad func() [16]uint8
+}
+
+// emulateCycle - executes one instruction, returning an *ExecError if it
+// could not be executed
+func (emu *Go8) emulateCycle() error {
+	if emu.vblankWait || emu.exited {
+		return nil
+	}
+	if int(emu.pc)+2 > len(emu.memory) {
+		return &ExecError{PC: emu.pc, Kind: MemoryOutOfBounds}
+	}
+	emu.err = nil
+	emu.opcode = emu.getOpcode()
+	emu.execute(Decode(emu.opcode))
+	return emu.err
+}
+
+// execute - runs the handler for inst, or faults if it is invalid
+func (emu *Go8) execute(inst Instruction) {
+	if inst.exec == nil {
+		emu.fault(UnknownOpcode)
+		return
+	}
+	inst.exec(emu)
 }
 
-var mathOpTable = []func(*Go8){
-	0x0000: (*Go8).setRegs,
-	0x0001: (*Go8).orRegs,
-	0x0002: (*Go8).andRegs,
-	0x0003: (*Go8).xorRegs,
-	0x0004: (*Go8).addRegs,
-	0x0005: (*Go8).subRegs,
-	0x0006: (*Go8).rshift,
-	0x0007: (*Go8).subRegsReverse,
-	0x000E: (*Go8).lshift,
-}
-
-var utilOpTable = []func(*Go8){
-	0x0007: (*Go8).storeDelay,
-	0x000A: (*Go8).getKey,
-	0x0015: (*Go8).setDelay,
-	0x0018: (*Go8).setSound,
-	0x001E: (*Go8).addToIndex,
-	0x0029: (*Go8).getSprite,
-	0x0033: (*Go8).storeBCD,
-	0x0055: (*Go8).regDump,
-	0x0065: (*Go8).regLoad,
-}
-
-var opTable = []func(*Go8){
-	0x0000: func(emu *Go8) {
-		switch emu.opcode & 0xF000 {
-		case 0x0000:
-			switch emu.opcode & 0x000F {
-			case 0x0000:
-				emu.clearScreen()
-			case 0x000E:
-				emu.ret()
+// RunFrame - runs one frame: reads the keypad, executes cyclesPerFrame
+// instructions, ticks the timers and presents the display.
+// Execution stops early if an instruction waits for the next frame.
+func (emu *Go8) RunFrame() error {
+	emu.vblank()
+	if emu.keypad != nil {
+		emu.key = emu.keypad()
+	} else {
+		emu.setKeys()
+	}
+	for i := 0; i < emu.cyclesPerFrame && !emu.vblankWait && !emu.exited; i++ {
+		if emu.beforeCycle != nil {
+			if err := emu.beforeCycle(); err != nil {
+				return err
 			}
 		}
-	},
-	0x1000: (*Go8).jump,
-	0x2000: (*Go8).callSubroutine,
-	0x3000: (*Go8).ifEqual,
-	0x4000: (*Go8).ifNotEqual,
-	0x5000: (*Go8).ifEqualReg,
-	0x6000: (*Go8).setConstant,
-	0x7000: (*Go8).addConstant,
-	0x8000: func(emu *Go8) {
-		op := mathOpTable[emu.opcode&0x000F]
-		if op == nil {
-			fmt.Printf("Unknown opcode: %x\n", emu.opcode)
-		} else {
-			op(emu)
-		}
-	},
-	0x9000: (*Go8).ifNotEqualReg,
-	0xA000: (*Go8).setIndex,
-	0xB000: (*Go8).addJump,
-	0xC000: (*Go8).rand,
-	0xD000: (*Go8).draw,
-	0xE000: func(emu *Go8) {
-		switch emu.opcode & 0x00FF {
-		case 0x009E:
-			emu.ifPressed()
-		case 0x00A1:
-			emu.ifNotPressed()
-		}
-	},
-	0xF000: func(emu *Go8) {
-		op := utilOpTable[emu.opcode&0x00FF]
-		if op == nil {
-			fmt.Printf("Unknown opcode: %x\n", emu.opcode)
-		} else {
-			op(emu)
+		if err := emu.emulateCycle(); err != nil {
+			return err
 		}
-	},
+	}
+	emu.tickTimers()
+	emu.updateWindow()
+	emu.drawFlag = false
+	return nil
 }
 
-func (emu *Go8) emulateCycle() {
-	emu.opcode = emu.getOpcode()
-	op := opTable[emu.opcode&0xF000]
-	if op == nil {
-		fmt.Printf("Unknown opcode: %x\n", emu.opcode)
-	} else {
-		op(emu)
+// fault - aborts the current instruction, handlers must return without
+// changing any state after calling it
+func (emu *Go8) fault(kind ErrorKind) {
+	emu.err = &ExecError{PC: emu.pc, Opcode: emu.opcode, Kind: kind}
+}
+
+// checkMem - faults if n bytes starting at addr are not all in memory
+func (emu *Go8) checkMem(addr uint16, n int) bool {
+	if int(addr)+n > len(emu.memory) {
+		emu.fault(MemoryOutOfBounds)
+		return false
 	}
-	emu.updateTimers()
+	return true
 }
 
-func newGo8(s SoundDevice, g GraphicsDevice) *Go8 {
+// newGo8 - a machine with the given devices, quirks and random source,
+// which is seeded from the clock if nil
+func newGo8(s SoundDevice, g GraphicsDevice, q Quirks, rng Random) *Go8 {
 	go8 := Go8{}
 	go8.initialize()
+	go8.quirks = q
+	go8.cyclesPerFrame = defaultCyclesPerFrame
+	go8.tone = defaultTone
+	if rng == nil {
+		rng = newSplitMix(uint64(time.Now().UnixNano()))
+	}
+	go8.rng = rng
 	go8.sound = s
 	go8.graphics = g
 	return &go8
@@ -136,31 +168,77 @@ func (emu *Go8) initialize() {
 	emu.index = 0x0000
 	emu.pc = startPc
 	memset(emu.gfx[:], 0x00)
+	emu.hires = false
+	emu.plane = 1
 	emu.delayTimer = 0x00
 	emu.soundTimer = 0x00
+	emu.timerPhase = 0
+	memset(emu.audio.buffer[:], 0x00)
+	emu.audio.pitch = defaultPitch
+	emu.audioLoaded = false
 	memset16(emu.stack[:], 0x00)
 	emu.sp = 0x00
 	memset(emu.key[:], 0x00)
 	emu.drawFlag = false
-	for i := 0; i < 80; i++ {
-		emu.memory[spriteMem+i] = fontset[i]
-	}
+	emu.vblankWait = false
+	emu.exited = false
+	copy(emu.memory[spriteMem:], fontset[:])
+	copy(emu.memory[bigSpriteMem:], bigFontset[:])
 }
 
-func (emu *Go8) loadROM(filename string) {
+func (emu *Go8) loadROM(filename string) error {
 	data, err := ioutil.ReadFile(filename)
-	check(err)
-	for i := 0; i < len(data); i++ {
-		emu.memory[i+0x200] = data[i]
+	if err != nil {
+		return err
+	}
+	return emu.loadROMData(data)
+}
+
+// loadROMData - copies a ROM to the program area, e.g. one loaded by a web
+// page
+func (emu *Go8) loadROMData(data []byte) error {
+	if len(data) > len(emu.memory)-startPc {
+		return &ExecError{PC: startPc, Kind: ROMTooLarge}
 	}
+	copy(emu.memory[startPc:], data)
+	return nil
 }
 
 func (emu *Go8) updateWindow() {
-	emu.graphics.updateWindow(emu.gfx[:])
+	w, h := emu.width(), emu.height()
+	gfx := emu.gfx[:w*h]
+	if emu.filter != nil {
+		gfx = emu.filter.apply(gfx, int(w), int(h))
+	}
+	emu.graphics.updateWindow(gfx, int(w), int(h))
+}
+
+func (emu *Go8) width() uint16 {
+	if emu.hires {
+		return hiresWidth
+	}
+	return screenWidth
+}
+
+func (emu *Go8) height() uint16 {
+	if emu.hires {
+		return hiresHeight
+	}
+	return screenHeight
 }
 
 func (emu *Go8) getOpcode() uint16 {
-	return uint16(emu.memory[emu.pc])<<8 | uint16(emu.memory[emu.pc+1])
+	return emu.opcodeAt(emu.pc)
+}
+
+func (emu *Go8) opcodeAt(addr uint16) uint16 {
+	return uint16(emu.memory[addr])<<8 | uint16(emu.memory[addr+1])
+}
+
+// skipNext - skips the instruction after the current one, which is four
+// bytes long if it is an XO-CHIP long index load
+func (emu *Go8) skipNext() {
+	emu.pc += uint16(instructionLength(emu.opcodeAt(emu.pc + 2)))
 }
 
 func (emu *Go8) setKeys() {
@@ -172,19 +250,66 @@ func (emu *Go8) setKeys() {
 	}
 }
 
+// vblank - signals the start of a new frame to instructions waiting on it
+func (emu *Go8) vblank() {
+	emu.vblankWait = false
+}
+
+// tickTimers - ticks the timers as often as they do at timerRate in one
+// frame at frameRate: once a frame at 60 frames per second, every other
+// frame at 120 and twice a frame at 30
+func (emu *Go8) tickTimers() {
+	emu.timerPhase += timerRate
+	for frameRate := emu.framesPerSecond(); emu.timerPhase >= frameRate; {
+		emu.timerPhase -= frameRate
+		emu.updateTimers()
+	}
+}
+
+// framesPerSecond - the frame rate RunFrame is called at
+func (emu *Go8) framesPerSecond() int {
+	if emu.frameRate == 0 {
+		return timerRate
+	}
+	return emu.frameRate
+}
+
 func (emu *Go8) updateTimers() {
 	if emu.delayTimer > 0 {
 		emu.delayTimer--
 	}
 	if emu.soundTimer > 0 {
-		if emu.soundTimer == 1 {
-			emu.sound.playSound()
-		}
 		emu.soundTimer--
+		if emu.soundTimer == 0 {
+			emu.sound.stop()
+		}
+	}
+}
+
+// voice - the sound played while the sound timer runs: the XO-CHIP pattern
+// once one is loaded, the buzzer before
+func (emu *Go8) voice() generator {
+	if emu.audioLoaded {
+		return newPatternGenerator(emu.audio, emu.tone.volume)
+	}
+	return newToneGenerator(emu.tone)
+}
+
+// updateSound - starts, restarts or stops the sound to match the sound
+// timer
+func (emu *Go8) updateSound() {
+	if emu.soundTimer > 0 {
+		emu.sound.start(emu.voice())
+	} else {
+		emu.sound.stop()
 	}
 }
 
 func (emu *Go8) callSubroutine() {
+	if int(emu.sp) >= len(emu.stack) {
+		emu.fault(StackOverflow)
+		return
+	}
 	emu.stack[emu.sp] = emu.pc
 	emu.sp++
 	emu.pc = emu.opcode & 0x0FFF
@@ -195,11 +320,71 @@ func (emu *Go8) jump() {
 }
 
 func (emu *Go8) ret() {
+	if emu.sp == 0 {
+		emu.fault(StackUnderflow)
+		return
+	}
 	emu.pc = emu.stack[emu.sp-1] + 2
 	emu.sp--
 }
 
 func (emu *Go8) clearScreen() {
+	for i := range emu.gfx {
+		emu.gfx[i] &^= emu.plane
+	}
+	emu.drawFlag = true
+	emu.pc += 2
+}
+
+func (emu *Go8) scrollDown() {
+	emu.scroll(0, int(emu.opcode&0x000F))
+}
+
+func (emu *Go8) scrollUp() {
+	emu.scroll(0, -int(emu.opcode&0x000F))
+}
+
+func (emu *Go8) scrollRight() {
+	emu.scroll(4, 0)
+}
+
+func (emu *Go8) scrollLeft() {
+	emu.scroll(-4, 0)
+}
+
+// scroll - moves the selected planes by dx, dy pixels, filling the
+// uncovered area with blank pixels
+func (emu *Go8) scroll(dx, dy int) {
+	w, h := int(emu.width()), int(emu.height())
+	old := emu.gfx
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var bits uint8
+			sx, sy := x-dx, y-dy
+			if sx >= 0 && sx < w && sy >= 0 && sy < h {
+				bits = old[sx+sy*w] & emu.plane
+			}
+			emu.gfx[x+y*w] = emu.gfx[x+y*w]&^emu.plane | bits
+		}
+	}
+	emu.drawFlag = true
+	emu.pc += 2
+}
+
+func (emu *Go8) exit() {
+	emu.exited = true
+}
+
+func (emu *Go8) lowRes() {
+	emu.setResolution(false)
+}
+
+func (emu *Go8) highRes() {
+	emu.setResolution(true)
+}
+
+func (emu *Go8) setResolution(hires bool) {
+	emu.hires = hires
 	memset(emu.gfx[:], 0)
 	emu.drawFlag = true
 	emu.pc += 2
@@ -209,7 +394,7 @@ func (emu *Go8) ifEqual() {
 	x := emu.xreg()
 	n := emu.opcode & 0x00FF
 	if emu.V[x] == uint8(n) {
-		emu.pc += 2
+		emu.skipNext()
 	}
 	emu.pc += 2
 }
@@ -218,7 +403,7 @@ func (emu *Go8) ifNotEqual() {
 	x := emu.xreg()
 	n := emu.opcode & 0x00FF
 	if emu.V[x] != uint8(n) {
-		emu.pc += 2
+		emu.skipNext()
 	}
 	emu.pc += 2
 }
@@ -227,7 +412,7 @@ func (emu *Go8) ifEqualReg() {
 	x := emu.xreg()
 	y := emu.yreg()
 	if emu.V[x] == emu.V[y] {
-		emu.pc += 2
+		emu.skipNext()
 	}
 	emu.pc += 2
 }
@@ -236,7 +421,7 @@ func (emu *Go8) ifNotEqualReg() {
 	x := emu.xreg()
 	y := emu.yreg()
 	if emu.V[x] != emu.V[y] {
-		emu.pc += 2
+		emu.skipNext()
 	}
 	emu.pc += 2
 }
@@ -267,6 +452,9 @@ func (emu *Go8) orRegs() {
 	x := emu.xreg()
 	y := emu.yreg()
 	emu.V[x] |= emu.V[y]
+	if emu.quirks.VFReset {
+		emu.V[0xF] = 0
+	}
 	emu.pc += 2
 }
 
@@ -274,6 +462,9 @@ func (emu *Go8) andRegs() {
 	x := emu.xreg()
 	y := emu.yreg()
 	emu.V[x] &= emu.V[y]
+	if emu.quirks.VFReset {
+		emu.V[0xF] = 0
+	}
 	emu.pc += 2
 }
 
@@ -281,6 +472,9 @@ func (emu *Go8) xorRegs() {
 	x := emu.xreg()
 	y := emu.yreg()
 	emu.V[x] ^= emu.V[y]
+	if emu.quirks.VFReset {
+		emu.V[0xF] = 0
+	}
 	emu.pc += 2
 }
 
@@ -320,21 +514,30 @@ func (emu *Go8) subRegsReverse() {
 	emu.pc += 2
 }
 
+// rshift - VX = VY >> 1, or VX >> 1 with the shift quirk, leaving VY as it
+// is. The flag is set last, so it wins over the result for VF.
 func (emu *Go8) rshift() {
 	x := emu.xreg()
 	y := emu.yreg()
-	emu.V[0xF] = emu.V[y] & 0x01
-	emu.V[y] >>= 1
-	emu.V[x] = emu.V[y]
+	if emu.quirks.Shift {
+		y = x
+	}
+	value := emu.V[y]
+	emu.V[x] = value >> 1
+	emu.V[0xF] = value & 0x01
 	emu.pc += 2
 }
 
+// lshift - VX = VY << 1, like rshift
 func (emu *Go8) lshift() {
 	x := emu.xreg()
 	y := emu.yreg()
-	emu.V[0xF] = (emu.V[y] & 0x80) >> 7
-	emu.V[y] <<= 1
-	emu.V[x] = emu.V[y]
+	if emu.quirks.Shift {
+		y = x
+	}
+	value := emu.V[y]
+	emu.V[x] = value << 1
+	emu.V[0xF] = value >> 7
 	emu.pc += 2
 }
 
@@ -344,58 +547,121 @@ func (emu *Go8) setIndex() {
 }
 
 func (emu *Go8) addJump() {
-	emu.pc = uint16(emu.V[0]) + (emu.opcode & 0x0FFF)
+	var reg uint16
+	if emu.quirks.Jump {
+		reg = emu.xreg()
+	}
+	emu.pc = uint16(emu.V[reg]) + (emu.opcode & 0x0FFF)
+}
+
+// random - the random source, a machine made without newGo8 gets one with
+// a fixed seed
+func (emu *Go8) random() Random {
+	if emu.rng == nil {
+		emu.rng = newSplitMix(0)
+	}
+	return emu.rng
+}
+
+// RandomState - the state of the random source
+func (emu *Go8) RandomState() uint64 {
+	return emu.random().State()
+}
+
+// SetRandomState - restores a state read with RandomState
+func (emu *Go8) SetRandomState(state uint64) {
+	emu.random().SetState(state)
 }
 
 func (emu *Go8) rand() {
 	x := emu.xreg()
-	emu.V[x] = uint8(rand.Intn(256)) & uint8((emu.opcode & 0x00FF))
+	emu.V[x] = emu.random().Byte() & uint8((emu.opcode & 0x00FF))
 	emu.pc += 2
 }
 
 func (emu *Go8) draw() {
-	x := emu.V[emu.xreg()]
-	y := emu.V[emu.yreg()]
+	w, h := emu.width(), emu.height()
+	// the sprite origin always wraps, the sprite itself wraps or clips
+	x := uint16(emu.V[emu.xreg()]) % w
+	y := uint16(emu.V[emu.yreg()]) % h
 	height := emu.opcode & 0x000F
+	width := uint16(spriteWidth)
+	if height == 0 {
+		// SCHIP 16 x 16 sprite, two bytes per line
+		height, width = 16, 16
+	}
 
+	planes := uint16(emu.plane&1 + emu.plane>>1&1)
+	if !emu.checkMem(emu.index, int(planes*height*width/8)) {
+		return
+	}
 	emu.V[0xF] = 0
+	// with several planes selected, the sprite for each plane follows the
+	// previous one in memory
+	addr := emu.index
+	for plane := uint8(1); plane <= 2; plane <<= 1 {
+		if emu.plane&plane == 0 {
+			continue
+		}
+		emu.drawPlane(plane, addr, x, y, width, height)
+		addr += height * width / 8
+	}
+	emu.drawFlag = true
+	emu.vblankWait = emu.quirks.DisplayWait
+	emu.pc += 2
+}
+
+func (emu *Go8) drawPlane(plane uint8, addr, x, y, width, height uint16) {
+	w, h := emu.width(), emu.height()
 	var yline uint16
 	var xline uint16
 	for yline = 0; yline < height; yline++ {
-		pixelLine := uint16(emu.memory[emu.index+yline])
-		for xline = 0; xline < spriteWidth; xline++ {
-			if (pixelLine & (0x80 >> xline)) != 0 {
-				pixel := ((uint16(x) + xline + ((uint16(y) + yline) * 64)) % 2048)
-				emu.V[0xF] = emu.V[0xF] | emu.gfx[pixel]
-				// if emu.gfx[pixel] > 0 {
-				// 	fmt.Printf("pixelLine %b\n", pixelLine)
-				// 	fmt.Printf("pixel: %b\n", pixel)
-				// 	fmt.Printf("x: %d, y: %d, xline: %d, yline: %d, height: %d\n", x, y, xline, yline, height)
-				// }
-				emu.gfx[pixel] ^= 1
+		py := y + yline
+		if py >= h {
+			if emu.quirks.Clip {
+				break
+			}
+			py %= h
+		}
+		var pixelLine uint16
+		if width == 16 {
+			pixelLine = uint16(emu.memory[addr+yline*2])<<8 | uint16(emu.memory[addr+yline*2+1])
+		} else {
+			pixelLine = uint16(emu.memory[addr+yline]) << 8
+		}
+		for xline = 0; xline < width; xline++ {
+			px := x + xline
+			if px >= w {
+				if emu.quirks.Clip {
+					break
+				}
+				px %= w
+			}
+			if (pixelLine & (0x8000 >> xline)) != 0 {
+				pixel := px + py*w
+				if emu.gfx[pixel]&plane != 0 {
+					emu.V[0xF] = 1
+				}
+				emu.gfx[pixel] ^= plane
 			}
 		}
 	}
-	if emu.V[0xF] > 0 {
-		// prevent weird bugs where emu.gfx[n] > 1
-		emu.V[0xF] = 1
-	}
-	emu.drawFlag = true
-	emu.pc += 2
 }
 
+// ifPressed - skips if the key in VX is down. Like the VIP only the low
+// nibble of VX picks the key.
 func (emu *Go8) ifPressed() {
-	x := emu.V[emu.xreg()]
+	x := emu.V[emu.xreg()] & 0xF
 	if emu.key[x] == 1 {
-		emu.pc += 2
+		emu.skipNext()
 	}
 	emu.pc += 2
 }
 
 func (emu *Go8) ifNotPressed() {
-	x := emu.V[emu.xreg()]
+	x := emu.V[emu.xreg()] & 0xF
 	if emu.key[x] != 1 {
-		emu.pc += 2
+		emu.skipNext()
 	}
 	emu.pc += 2
 }
@@ -421,16 +687,45 @@ func (emu *Go8) setDelay() {
 	emu.pc += 2
 }
 
+// setSound - sounds for as many frames as the timer is set to. Setting it
+// again while it runs keeps the sound going without restarting it.
 func (emu *Go8) setSound() {
+	playing := emu.soundTimer > 0
 	emu.soundTimer = emu.V[emu.xreg()]
+	if playing != (emu.soundTimer > 0) {
+		emu.updateSound()
+	}
 	emu.pc += 2
 }
 
-func (emu *Go8) addToIndex() {
-	emu.V[0xF] = 0
-	if emu.index+uint16(emu.V[emu.xreg()]) > 0xFFF {
-		emu.V[0xF] = 1
+// loadPattern - copies the pattern at index, later changes to memory do
+// not affect it
+func (emu *Go8) loadPattern() {
+	if !emu.checkMem(emu.index, patternSize) {
+		return
+	}
+	var i uint16
+	for i = 0; i < patternSize; i++ {
+		emu.audio.buffer[i] = emu.memory[emu.index+i]
 	}
+	emu.audioLoaded = true
+	if emu.soundTimer > 0 {
+		emu.updateSound()
+	}
+	emu.pc += 2
+}
+
+func (emu *Go8) setPitch() {
+	emu.audio.pitch = emu.V[emu.xreg()]
+	if emu.soundTimer > 0 {
+		emu.updateSound()
+	}
+	emu.pc += 2
+}
+
+// addToIndex - FX1E, leaving VF alone like the VIP, SCHIP and XO-CHIP
+// interpreters; only the Amiga one flagged I passing 0xFFF
+func (emu *Go8) addToIndex() {
 	emu.index += uint16(emu.V[emu.xreg()])
 	emu.pc += 2
 }
@@ -441,7 +736,16 @@ func (emu *Go8) getSprite() {
 	emu.pc += 2
 }
 
+func (emu *Go8) getBigSprite() {
+	sprite := uint16(emu.V[emu.xreg()])
+	emu.index = bigSpriteMem + sprite*10
+	emu.pc += 2
+}
+
 func (emu *Go8) storeBCD() {
+	if !emu.checkMem(emu.index, 3) {
+		return
+	}
 	x := emu.V[emu.xreg()]
 	emu.memory[emu.index] = x / 100
 	emu.memory[emu.index+1] = (x / 10) % 10
@@ -451,21 +755,94 @@ func (emu *Go8) storeBCD() {
 
 func (emu *Go8) regDump() {
 	x := emu.xreg()
+	if !emu.checkMem(emu.index, int(x)+1) {
+		return
+	}
 	var i uint16
 	for i = 0; i <= x; i++ {
-		emu.memory[emu.index] = emu.V[i]
-		emu.index++
+		emu.memory[emu.index+i] = emu.V[i]
+	}
+	if !emu.quirks.LoadStore {
+		emu.index += x + 1
 	}
 	emu.pc += 2
 }
 
 func (emu *Go8) regLoad() {
 	x := emu.xreg()
+	if !emu.checkMem(emu.index, int(x)+1) {
+		return
+	}
 	var i uint16
 	for i = 0; i <= x; i++ {
-		emu.V[i] = emu.memory[emu.index]
-		emu.index++
+		emu.V[i] = emu.memory[emu.index+i]
+	}
+	if !emu.quirks.LoadStore {
+		emu.index += x + 1
+	}
+	emu.pc += 2
+}
+
+func (emu *Go8) saveFlags() {
+	x := emu.xreg()
+	copy(emu.rpl[:x+1], emu.V[:x+1])
+	emu.pc += 2
+}
+
+func (emu *Go8) loadFlags() {
+	x := emu.xreg()
+	copy(emu.V[:x+1], emu.rpl[:x+1])
+	emu.pc += 2
+}
+
+func (emu *Go8) saveRange() {
+	x, y := emu.xreg(), emu.yreg()
+	if !emu.checkMem(emu.index, int(rangeLen(x, y))+1) {
+		return
+	}
+	for i := uint16(0); i <= rangeLen(x, y); i++ {
+		emu.memory[emu.index+i] = emu.V[rangeReg(x, y, i)]
+	}
+	emu.pc += 2
+}
+
+func (emu *Go8) loadRange() {
+	x, y := emu.xreg(), emu.yreg()
+	if !emu.checkMem(emu.index, int(rangeLen(x, y))+1) {
+		return
+	}
+	for i := uint16(0); i <= rangeLen(x, y); i++ {
+		emu.V[rangeReg(x, y, i)] = emu.memory[emu.index+i]
+	}
+	emu.pc += 2
+}
+
+// rangeLen - number of registers after the first in a 5XY2/5XY3 range
+func rangeLen(x, y uint16) uint16 {
+	if x > y {
+		return x - y
+	}
+	return y - x
+}
+
+// rangeReg - the i-th register of a range, which runs backwards if X > Y
+func rangeReg(x, y, i uint16) uint16 {
+	if x > y {
+		return x - i
 	}
+	return x + i
+}
+
+func (emu *Go8) longIndex() {
+	if !emu.checkMem(emu.pc, 4) {
+		return
+	}
+	emu.index = emu.opcodeAt(emu.pc + 2)
+	emu.pc += 4
+}
+
+func (emu *Go8) selectPlane() {
+	emu.plane = uint8(emu.xreg()) & 0x3
 	emu.pc += 2
 }
 
@@ -513,3 +890,22 @@ var fontset = [80]uint8{
 	0xF0, 0x80, 0xF0, 0x80, 0xF0, // E
 	0xF0, 0x80, 0xF0, 0x80, 0x80, // F
 }
+
+var bigFontset = [160]uint8{
+	0x3C, 0x7E, 0xE7, 0xC3, 0xC3, 0xC3, 0xC3, 0xE7, 0x7E, 0x3C, // 0
+	0x18, 0x38, 0x58, 0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x3C, // 1
+	0x3E, 0x7F, 0xC3, 0x06, 0x0C, 0x18, 0x30, 0x60, 0xFF, 0xFF, // 2
+	0x3C, 0x7E, 0xC3, 0x03, 0x0E, 0x0E, 0x03, 0xC3, 0x7E, 0x3C, // 3
+	0x06, 0x0E, 0x1E, 0x36, 0x66, 0xC6, 0xFF, 0xFF, 0x06, 0x06, // 4
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFC, 0xFE, 0x03, 0xC3, 0x7E, 0x3C, // 5
+	0x3E, 0x7C, 0xE0, 0xC0, 0xFC, 0xFE, 0xC3, 0xC3, 0x7E, 0x3C, // 6
+	0xFF, 0xFF, 0x03, 0x06, 0x0C, 0x18, 0x30, 0x60, 0x60, 0x60, // 7
+	0x3C, 0x7E, 0xC3, 0xC3, 0x7E, 0x7E, 0xC3, 0xC3, 0x7E, 0x3C, // 8
+	0x3C, 0x7E, 0xC3, 0xC3, 0x7F, 0x3F, 0x03, 0x03, 0x3E, 0x7C, // 9
+	0x3C, 0x7E, 0xC3, 0xC3, 0xFF, 0xFF, 0xC3, 0xC3, 0xC3, 0xC3, // A
+	0xFC, 0xFE, 0xC3, 0xC3, 0xFE, 0xFE, 0xC3, 0xC3, 0xFE, 0xFC, // B
+	0x3C, 0x7E, 0xC3, 0xC0, 0xC0, 0xC0, 0xC0, 0xC3, 0x7E, 0x3C, // C
+	0xFC, 0xFE, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xFE, 0xFC, // D
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, // E
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xC0, 0xC0, // F
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -28,6 +27,8 @@ func TestInitialize(t *testing.T) {
 	go8.index = 0x12
 	go8.pc = 0xF3E4
 	go8.gfx[2047] = 0xFF
+	go8.hires = true
+	go8.plane = 3
 	go8.delayTimer = 0x23
 	go8.soundTimer = 0x34
 	go8.stack[14] = 0x0F
@@ -54,10 +55,7 @@ func TestInitialize(t *testing.T) {
 }
 
 func TestReadROM(t *testing.T) {
-	ex, err := os.Executable()
-	check(err)
-	path := filepath.Dir(ex)
-	f, err := ioutil.TempFile(path, "")
+	f, err := ioutil.TempFile("", "")
 	tmprom := f.Name()
 	check(err)
 
@@ -66,7 +64,9 @@ func TestReadROM(t *testing.T) {
 	f.Close()
 
 	go8 := Go8{}
-	go8.loadROM(tmprom)
+	if err := go8.loadROM(tmprom); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
 	for i := 0; i < len(buf); i++ {
 		if go8.memory[i+512] != 0x55 {
 			t.Errorf("Invalid memory state. Got %d, wanted %d", go8.memory[i], 0x55)
@@ -89,12 +89,198 @@ func TestEmulateCycleSubroutine(t *testing.T) {
 	if go8.sp != 0x1 {
 		t.Errorf("Wrong sp. Got %x, expected %x.", go8.sp, 0x1)
 	}
-	if go8.delayTimer != 1 {
-		t.Errorf("Wrong delay timer. Got %d, expected %d.", go8.delayTimer, 1)
+	// timers only tick once per frame
+	if go8.delayTimer != 2 {
+		t.Errorf("Wrong delay timer. Got %d, expected %d.", go8.delayTimer, 2)
 	}
 	checkPc(0x222, go8.pc, t)
 }
 
+func TestRunFrame(t *testing.T) {
+	graphics := &testGraphics{}
+	go8 := newGo8(&testSound{}, graphics, Quirks{}, nil)
+	go8.cyclesPerFrame = 3
+	// V0 += 1 in a loop
+	copy(go8.memory[0x200:], []uint8{0x70, 0x01, 0x12, 0x00})
+	go8.delayTimer = 10
+	graphics.keys[0x5] = true
+	if err := go8.RunFrame(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if go8.V[0] != 2 {
+		t.Errorf("Wrong number of instructions executed. Got V[0] %d, expected %d.", go8.V[0], 2)
+	}
+	if go8.delayTimer != 9 {
+		t.Errorf("Wrong delay timer. Got %d, expected %d.", go8.delayTimer, 9)
+	}
+	if len(graphics.frames) != 1 {
+		t.Errorf("Wrong number of frames presented. Got %d, expected %d.", len(graphics.frames), 1)
+	}
+	if go8.key[0x5] != 1 {
+		t.Error("Keypad not read.")
+	}
+}
+
+func TestRunFrameTimerRate(t *testing.T) {
+	tests := []struct {
+		frameRate int
+		frames    int
+		expected  uint8
+	}{
+		{0, 3, 7},
+		{60, 3, 7},
+		{30, 3, 4},
+		{120, 3, 9},
+		{120, 4, 8},
+		{90, 3, 8},
+		{25, 5, 0},
+	}
+	for _, test := range tests {
+		go8 := newGo8(&testSound{}, &testGraphics{}, Quirks{}, nil)
+		go8.frameRate = test.frameRate
+		copy(go8.memory[0x200:], []uint8{0x12, 0x00})
+		go8.delayTimer = 10
+		for i := 0; i < test.frames; i++ {
+			go8.RunFrame()
+		}
+		if go8.delayTimer != test.expected {
+			t.Errorf("%d fps: Wrong delay timer after %d frames. Got %d, expected %d.",
+				test.frameRate, test.frames, go8.delayTimer, test.expected)
+		}
+	}
+}
+
+func TestRunFrameDisplayWait(t *testing.T) {
+	go8 := newGo8(&testSound{}, &testGraphics{}, Quirks{DisplayWait: true}, nil)
+	go8.cyclesPerFrame = 10
+	// draw and increment V0 in a loop
+	copy(go8.memory[0x200:], []uint8{0xD0, 0x01, 0x70, 0x01, 0x12, 0x00})
+	go8.RunFrame()
+	go8.RunFrame()
+	if go8.V[0] != 1 {
+		t.Errorf("Wrong number of draws. Got V[0] %d, expected %d.", go8.V[0], 1)
+	}
+}
+
+func TestRunFrameDeterministic(t *testing.T) {
+	// moves a sprite right by one pixel per delay timer period
+	program := []uint8{
+		0xA2, 0x10, // index = sprite
+		0xD0, 0x11, // draw
+		0x61, 0x02, // V1 = 2
+		0xF1, 0x15, // delay = V1
+		0xF1, 0x07, // V1 = delay
+		0x31, 0x00, // skip if V1 == 0
+		0x12, 0x08, // wait
+		0xD0, 0x11, // erase
+		0x70, 0x01, // V0 += 1
+		0x12, 0x02, // loop
+	}
+	run := func() [][]uint8 {
+		graphics := &testGraphics{}
+		go8 := newGo8(&testSound{}, graphics, Quirks{}, nil)
+		copy(go8.memory[0x200:], program)
+		go8.memory[0x210] = 0x80
+		for i := 0; i < 30; i++ {
+			if err := go8.RunFrame(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		return graphics.frames
+	}
+	first, second := run(), run()
+	if !reflect.DeepEqual(first, second) {
+		t.Error("Frame sequences differ between runs.")
+	}
+	if reflect.DeepEqual(first[0], first[len(first)-1]) {
+		t.Error("Display never changed.")
+	}
+}
+
+type testGraphics struct {
+	frames [][]uint8
+	keys   [16]bool
+}
+
+func (graphics *testGraphics) updateWindow(gfx []uint8, w, h int) {
+	frame := make([]uint8, len(gfx))
+	copy(frame, gfx)
+	graphics.frames = append(graphics.frames, frame)
+}
+
+func (graphics *testGraphics) closed() bool {
+	return false
+}
+
+func (graphics *testGraphics) pressed(key int) bool {
+	return graphics.keys[key]
+}
+
+func TestExecErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		opcode uint16
+		setup  func(*Go8)
+		kind   ErrorKind
+	}{
+		{"unknown math", 0x800F, nil, UnknownOpcode},
+		{"unknown util", 0xF0FF, nil, UnknownOpcode},
+		{"unknown key", 0xE0FF, nil, UnknownOpcode},
+		{"unknown sys", 0x0123, nil, UnknownOpcode},
+		{"unknown range", 0x5129, nil, UnknownOpcode},
+		{"stack overflow", 0x2300, func(emu *Go8) { emu.sp = 16 }, StackOverflow},
+		{"stack underflow", 0x00EE, nil, StackUnderflow},
+		{"draw out of bounds", 0xD005, func(emu *Go8) { emu.index = 0xFFFE }, MemoryOutOfBounds},
+		{"dump out of bounds", 0xFF55, func(emu *Go8) { emu.index = 0xFFFA }, MemoryOutOfBounds},
+		{"bcd out of bounds", 0xF033, func(emu *Go8) { emu.index = 0xFFFF }, MemoryOutOfBounds},
+	}
+	for _, test := range tests {
+		go8 := Go8{}
+		go8.initialize()
+		go8.pc = 0x512
+		go8.memory[0x512] = uint8(test.opcode >> 8)
+		go8.memory[0x513] = uint8(test.opcode)
+		if test.setup != nil {
+			test.setup(&go8)
+		}
+		err := go8.emulateCycle()
+		execErr, ok := err.(*ExecError)
+		if !ok {
+			t.Errorf("%s: expected *ExecError, got %v.", test.name, err)
+			continue
+		}
+		if execErr.Kind != test.kind || execErr.PC != 0x512 || execErr.Opcode != test.opcode {
+			t.Errorf("%s: wrong error. Got %+v.", test.name, execErr)
+		}
+		// the faulting instruction does not advance
+		checkPc(0x512, go8.pc, t)
+	}
+}
+
+func TestExecNoError(t *testing.T) {
+	go8 := Go8{}
+	go8.initialize()
+	go8.memory[0x200] = 0x60
+	go8.memory[0x201] = 0x01
+	if err := go8.emulateCycle(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestROMTooLarge(t *testing.T) {
+	f, err := ioutil.TempFile("", "")
+	check(err)
+	defer os.Remove(f.Name())
+	f.Write(make([]byte, 0x10000-0x200+1))
+	f.Close()
+
+	go8 := Go8{}
+	err = go8.loadROM(f.Name())
+	if execErr, ok := err.(*ExecError); !ok || execErr.Kind != ROMTooLarge {
+		t.Errorf("Expected ROM too large error, got %v.", err)
+	}
+}
+
 func TestCallSubroutine(t *testing.T) {
 	go8 := Go8{}
 	go8.initialize()
@@ -138,7 +324,7 @@ func TestClearScreen(t *testing.T) {
 	go8.opcode = 0x1111
 	go8.pc = 0x512
 	for i := 0; i < len(go8.gfx); i++ {
-		go8.gfx[i] = 0x12
+		go8.gfx[i] = 0x1
 	}
 	go8.clearScreen()
 	if !allArrZero(go8.gfx[:]) {
@@ -401,8 +587,9 @@ func TestRshift(t *testing.T) {
 	if go8.V[1] != 0x01 {
 		t.Errorf("Wrong value for V[1]. Got %x, expected %x.", go8.V[1], 0x01)
 	}
-	if go8.V[2] != 0x01 {
-		t.Errorf("Wrong value for V[2]. Got %x, expected %x.", go8.V[2], 0x01)
+	// VY is left as it is
+	if go8.V[2] != 0x03 {
+		t.Errorf("Wrong value for V[2]. Got %x, expected %x.", go8.V[2], 0x03)
 	}
 	// VF is set to the value of the least significant bit of VY before the shift.
 	if go8.V[0xF] != 1 {
@@ -421,8 +608,8 @@ func TestLshift(t *testing.T) {
 	if go8.V[1] != 0x06 {
 		t.Errorf("Wrong value for V[1]. Got %x, expected %x.", go8.V[1], 0x06)
 	}
-	if go8.V[2] != 0x06 {
-		t.Errorf("Wrong value for V[2]. Got %x, expected %x.", go8.V[2], 0x06)
+	if go8.V[2] != 0x83 {
+		t.Errorf("Wrong value for V[2]. Got %x, expected %x.", go8.V[2], 0x83)
 	}
 	// VF is set to the value of the least significant bit of VY before the shift.
 	if go8.V[0xF] != 1 {
@@ -455,11 +642,15 @@ func TestAddJump(t *testing.T) {
 func TestRand(t *testing.T) {
 	go8 := Go8{}
 	go8.initialize()
+	go8.rng = newSplitMix(1)
 	go8.pc = 0x512
-	go8.opcode = 0xC123
-	// TODO: figure out how to actually test this (constant seed)
+	go8.opcode = 0xC10F
 	go8.rand()
 	checkPc(0x512+0x2, go8.pc, t)
+	expected := newSplitMix(1).Byte() & 0x0F
+	if go8.V[1] != expected {
+		t.Errorf("Wrong random value. Got %x, expected %x.", go8.V[1], expected)
+	}
 }
 
 func TestDraw(t *testing.T) {
@@ -499,6 +690,286 @@ func TestDraw(t *testing.T) {
 	}
 }
 
+func TestResolution(t *testing.T) {
+	go8 := Go8{}
+	go8.initialize()
+	go8.pc = 0x512
+	go8.gfx[0] = 1
+	go8.highRes()
+	if !go8.hires || go8.width() != 128 || go8.height() != 64 {
+		t.Errorf("Not in hires mode. Got %dx%d.", go8.width(), go8.height())
+	}
+	if !allArrZero(go8.gfx[:]) {
+		t.Error("Gfx not cleared on mode switch.")
+	}
+	checkPc(0x512+2, go8.pc, t)
+	go8.lowRes()
+	if go8.hires || go8.width() != 64 || go8.height() != 32 {
+		t.Errorf("Not in lores mode. Got %dx%d.", go8.width(), go8.height())
+	}
+	checkPc(0x512+4, go8.pc, t)
+}
+
+func TestDrawBigSprite(t *testing.T) {
+	go8 := Go8{}
+	go8.initialize()
+	go8.hires = true
+	go8.opcode = 0xD010
+	go8.V[0] = 120
+	go8.V[1] = 1
+	go8.index = 0x300
+	for i := 0; i < 32; i += 2 {
+		go8.memory[0x300+i] = 0x80
+		go8.memory[0x300+i+1] = 0x01
+	}
+	go8.draw()
+	for y := 1; y < 17; y++ {
+		if go8.gfx[120+y*128] != 1 {
+			t.Errorf("Left column not drawn at line %d.", y)
+		}
+		// the right edge wraps around to the start of the line
+		if go8.gfx[7+y*128] != 1 {
+			t.Errorf("Right column not drawn at line %d.", y)
+		}
+	}
+	if go8.gfx[120+17*128] != 0 {
+		t.Error("Sprite taller than 16 lines.")
+	}
+	go8.draw()
+	if go8.V[0xF] != 1 {
+		t.Errorf("Collision not detected. Got %d, expected %d.", go8.V[0xF], 1)
+	}
+}
+
+func TestScroll(t *testing.T) {
+	tests := []struct {
+		name     string
+		opcode   uint16
+		hires    bool
+		expected int
+	}{
+		{"down lores", 0x00C3, false, 10 + 8*64},
+		{"down hires", 0x00C3, true, 10 + 8*128},
+		{"right lores", 0x00FB, false, 14 + 5*64},
+		{"right hires", 0x00FB, true, 14 + 5*128},
+		{"left lores", 0x00FC, false, 6 + 5*64},
+		{"left hires", 0x00FC, true, 6 + 5*128},
+	}
+	for _, test := range tests {
+		go8 := Go8{}
+		go8.initialize()
+		go8.hires = test.hires
+		go8.pc = 0x512
+		go8.opcode = test.opcode
+		go8.gfx[10+5*int(go8.width())] = 1
+		go8.execute(Decode(test.opcode))
+		for i, p := range go8.gfx {
+			if i == test.expected && p != 1 {
+				t.Errorf("%s: pixel not moved to %d.", test.name, test.expected)
+			} else if i != test.expected && p != 0 {
+				t.Errorf("%s: unexpected pixel at %d.", test.name, i)
+			}
+		}
+		checkPc(0x512+2, go8.pc, t)
+	}
+}
+
+func TestExit(t *testing.T) {
+	go8 := Go8{}
+	go8.initialize()
+	go8.memory[0x200] = 0x00
+	go8.memory[0x201] = 0xFD
+	go8.memory[0x202] = 0x60
+	go8.memory[0x203] = 0x01
+	go8.emulateCycle()
+	go8.emulateCycle()
+	if !go8.exited {
+		t.Error("Emulator did not exit.")
+	}
+	if go8.V[0] != 0 {
+		t.Error("Instructions executed after exit.")
+	}
+}
+
+func TestGetBigSprite(t *testing.T) {
+	go8 := Go8{}
+	go8.initialize()
+	go8.pc = 0x512
+	go8.opcode = 0xF030
+	go8.V[0] = 0x6
+	go8.getBigSprite()
+	if go8.index != 0xA0+10*6 {
+		t.Errorf("Wrong index. Got %x, expected %x.", go8.index, 0xA0+10*6)
+	}
+	if go8.memory[go8.index] != bigFontset[60] {
+		t.Errorf("Wrong font data. Got %x, expected %x.", go8.memory[go8.index], bigFontset[60])
+	}
+	checkPc(0x512+2, go8.pc, t)
+}
+
+func TestFlags(t *testing.T) {
+	go8 := Go8{}
+	go8.initialize()
+	go8.pc = 0x512
+	go8.opcode = 0xF275
+	go8.V[0] = 0x1
+	go8.V[1] = 0x2
+	go8.V[2] = 0x3
+	go8.V[3] = 0x4
+	go8.saveFlags()
+	go8.initialize()
+	go8.pc = 0x512
+	go8.opcode = 0xF385
+	go8.loadFlags()
+	if go8.V[0] != 0x1 || go8.V[1] != 0x2 || go8.V[2] != 0x3 || go8.V[3] != 0x0 {
+		t.Errorf("Flags not restored. Got %v, expected %v.", go8.V[0:4], []uint8{0x1, 0x2, 0x3, 0x0})
+	}
+	checkPc(0x512+2, go8.pc, t)
+}
+
+func TestClearPlane(t *testing.T) {
+	go8 := Go8{}
+	go8.initialize()
+	go8.pc = 0x512
+	go8.plane = 2
+	for i := 0; i < len(go8.gfx); i++ {
+		go8.gfx[i] = 0x3
+	}
+	go8.clearScreen()
+	for i := 0; i < len(go8.gfx); i++ {
+		if go8.gfx[i] != 0x1 {
+			t.Fatalf("Wrong pixel at %d. Got %d, expected %d.", i, go8.gfx[i], 0x1)
+		}
+	}
+	checkPc(0x512+2, go8.pc, t)
+}
+
+func TestDrawPlanes(t *testing.T) {
+	go8 := Go8{}
+	go8.initialize()
+	go8.opcode = 0xD001
+	go8.index = 0x300
+	go8.memory[0x300] = 0xC0
+	go8.memory[0x301] = 0x60
+	go8.plane = 3
+	go8.draw()
+	expected := []uint8{1, 3, 2, 0}
+	if !reflect.DeepEqual(go8.gfx[0:4], expected) {
+		t.Errorf("Graphics mismatch. Expected %v, got %v.", expected, go8.gfx[0:4])
+	}
+	if go8.V[0xF] != 0 {
+		t.Errorf("Unexpected collision. Got %d, expected %d.", go8.V[0xF], 0)
+	}
+	go8.plane = 2
+	go8.draw()
+	expected = []uint8{3, 1, 2, 0}
+	if !reflect.DeepEqual(go8.gfx[0:4], expected) {
+		t.Errorf("Graphics mismatch. Expected %v, got %v.", expected, go8.gfx[0:4])
+	}
+	if go8.V[0xF] != 1 {
+		t.Errorf("Collision not detected. Got %d, expected %d.", go8.V[0xF], 1)
+	}
+}
+
+func TestScrollPlane(t *testing.T) {
+	go8 := Go8{}
+	go8.initialize()
+	go8.opcode = 0x00D1
+	go8.plane = 1
+	go8.gfx[64] = 0x3
+	go8.scrollUp()
+	if go8.gfx[0] != 0x1 || go8.gfx[64] != 0x2 {
+		t.Errorf("Wrong planes scrolled. Got %d and %d, expected %d and %d.", go8.gfx[0], go8.gfx[64], 0x1, 0x2)
+	}
+}
+
+func TestSelectPlane(t *testing.T) {
+	go8 := Go8{}
+	go8.initialize()
+	go8.pc = 0x512
+	go8.opcode = 0xF201
+	go8.selectPlane()
+	if go8.plane != 2 {
+		t.Errorf("Wrong plane. Got %d, expected %d.", go8.plane, 2)
+	}
+	checkPc(0x512+2, go8.pc, t)
+}
+
+func TestLongIndex(t *testing.T) {
+	go8 := Go8{}
+	go8.initialize()
+	go8.memory[0x200] = 0xF0
+	go8.memory[0x201] = 0x00
+	go8.memory[0x202] = 0xBE
+	go8.memory[0x203] = 0xEF
+	go8.emulateCycle()
+	if go8.index != 0xBEEF {
+		t.Errorf("Wrong index. Got %x, expected %x.", go8.index, 0xBEEF)
+	}
+	checkPc(0x200+4, go8.pc, t)
+}
+
+func TestSkipLongIndex(t *testing.T) {
+	go8 := Go8{}
+	go8.initialize()
+	go8.pc = 0x512
+	go8.opcode = 0x3100
+	go8.memory[0x514] = 0xF0
+	go8.memory[0x515] = 0x00
+	go8.ifEqual()
+	checkPc(0x512+6, go8.pc, t)
+}
+
+func TestRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		opcode   uint16
+		expected []uint8
+		regs     []uint8
+	}{
+		{"forward", 0x5132, []uint8{0x1, 0x2, 0x3}, []uint8{0x1, 0x2, 0x3}},
+		{"backward", 0x5312, []uint8{0x3, 0x2, 0x1}, []uint8{0x1, 0x2, 0x3}},
+		{"single", 0x5222, []uint8{0x2, 0x0, 0x0}, []uint8{0x0, 0x2, 0x0}},
+	}
+	for _, test := range tests {
+		go8 := Go8{}
+		go8.initialize()
+		go8.pc = 0x512
+		go8.opcode = test.opcode
+		go8.index = 0x300
+		go8.V[1] = 0x1
+		go8.V[2] = 0x2
+		go8.V[3] = 0x3
+		go8.saveRange()
+		if !reflect.DeepEqual(go8.memory[0x300:0x303], test.expected) {
+			t.Errorf("%s: wrong memory. Got %v, expected %v.", test.name, go8.memory[0x300:0x303], test.expected)
+		}
+		if go8.index != 0x300 {
+			t.Errorf("%s: index changed. Got %x, expected %x.", test.name, go8.index, 0x300)
+		}
+		memset(go8.V[:], 0)
+		go8.opcode = test.opcode | 0x1
+		go8.loadRange()
+		if !reflect.DeepEqual(go8.V[1:4], test.regs) {
+			t.Errorf("%s: registers not restored. Got %v, expected %v.", test.name, go8.V[1:4], test.regs)
+		}
+		checkPc(0x512+4, go8.pc, t)
+	}
+}
+
+func TestLargeMemory(t *testing.T) {
+	go8 := Go8{}
+	go8.initialize()
+	go8.opcode = 0xF155
+	go8.index = 0xFFFE
+	go8.V[0] = 0x1
+	go8.V[1] = 0x2
+	go8.regDump()
+	if go8.memory[0xFFFE] != 0x1 || go8.memory[0xFFFF] != 0x2 {
+		t.Errorf("Values not stored in memory properly. Got %v.", go8.memory[0xFFFE:])
+	}
+}
+
 func TestIsPressed(t *testing.T) {
 	go8 := Go8{}
 	go8.initialize()
@@ -513,6 +984,17 @@ func TestIsPressed(t *testing.T) {
 	go8.V[0] = 0x5
 	go8.ifPressed()
 	checkPc(0x512+2, go8.pc, t)
+
+	// only the low nibble counts
+	go8.pc = 0x512
+	go8.V[0] = 0x14
+	go8.ifPressed()
+	checkPc(0x512+4, go8.pc, t)
+
+	go8.pc = 0x512
+	go8.V[0] = 0x10
+	go8.ifPressed()
+	checkPc(0x512+2, go8.pc, t)
 }
 
 func TestIsNotPressed(t *testing.T) {
@@ -529,6 +1011,16 @@ func TestIsNotPressed(t *testing.T) {
 	go8.V[0] = 0x5
 	go8.ifNotPressed()
 	checkPc(0x512+4, go8.pc, t)
+
+	go8.pc = 0x512
+	go8.V[0] = 0x10
+	go8.ifNotPressed()
+	checkPc(0x512+4, go8.pc, t)
+
+	go8.pc = 0x512
+	go8.V[0] = 0xF4
+	go8.ifNotPressed()
+	checkPc(0x512+2, go8.pc, t)
 }
 
 func TestStoreDelay(t *testing.T) {
@@ -544,6 +1036,37 @@ func TestStoreDelay(t *testing.T) {
 	checkPc(0x512+2, go8.pc, t)
 }
 
+func TestAddToIndex(t *testing.T) {
+	tests := []struct {
+		index    uint16
+		vx       uint8
+		expected uint16
+	}{
+		{0x300, 0x10, 0x310},
+		{0xFFF, 0x01, 0x1000},
+		// above 4 KiB after F000 NNNN
+		{0x1000, 0x20, 0x1020},
+		{0xFFFF, 0x02, 0x0001},
+	}
+	for _, test := range tests {
+		go8 := Go8{}
+		go8.initialize()
+		go8.pc = 0x512
+		go8.opcode = 0xF11E
+		go8.index = test.index
+		go8.V[1] = test.vx
+		go8.V[0xF] = 0x42
+		go8.addToIndex()
+		if go8.index != test.expected {
+			t.Errorf("Wrong index. Got %x, expected %x.", go8.index, test.expected)
+		}
+		if go8.V[0xF] != 0x42 {
+			t.Errorf("VF changed adding %x to %x. Got %x, expected %x.", test.vx, test.index, go8.V[0xF], 0x42)
+		}
+		checkPc(0x512+2, go8.pc, t)
+	}
+}
+
 func TestGetSprite(t *testing.T) {
 	go8 := Go8{}
 	go8.initialize()
@@ -598,18 +1121,217 @@ func TestRegLoad(t *testing.T) {
 	checkPc(0x512+2, go8.pc, t)
 }
 
-func TestSound(t *testing.T) {
-	sound := newSound("sound/beep.wav")
-	sound.playSound()
+func TestQuirkShift(t *testing.T) {
+	tests := []struct {
+		name     string
+		quirks   Quirks
+		opcode   uint16
+		expected uint8
+		carry    uint8
+	}{
+		{"rshift vy", Quirks{}, 0x8126, 0x41, 1},
+		{"rshift vx", Quirks{Shift: true}, 0x8126, 0x40, 0},
+		{"lshift vy", Quirks{}, 0x812E, 0x06, 1},
+		{"lshift vx", Quirks{Shift: true}, 0x812E, 0x00, 1},
+		// with VF as VX the flag replaces the result
+		{"rshift vf", Quirks{}, 0x8F26, 1, 1},
+		{"rshift vf quirk", Quirks{Shift: true}, 0x8F26, 1, 1},
+		{"lshift vf", Quirks{}, 0x8F2E, 1, 1},
+		{"lshift vf quirk", Quirks{Shift: true}, 0x8F2E, 0, 0},
+	}
+	for _, test := range tests {
+		go8 := Go8{}
+		go8.initialize()
+		go8.quirks = test.quirks
+		go8.opcode = test.opcode
+		go8.V[1] = 0x80
+		go8.V[2] = 0x83
+		go8.V[0xF] = 0x03
+		if test.opcode&0x000F == 0x6 {
+			go8.rshift()
+		} else {
+			go8.lshift()
+		}
+		x := go8.xreg()
+		if x != 0xF && go8.V[x] != test.expected {
+			t.Errorf("%s: wrong value for V[%X]. Got %x, expected %x.", test.name, x, go8.V[x], test.expected)
+		}
+		if go8.V[0xF] != test.carry {
+			t.Errorf("%s: wrong value for V[0xF]. Got %x, expected %x.", test.name, go8.V[0xF], test.carry)
+		}
+		if go8.V[2] != 0x83 {
+			t.Errorf("%s: VY changed. Got %x, expected 83.", test.name, go8.V[2])
+		}
+	}
+}
+
+func TestQuirkLoadStore(t *testing.T) {
+	tests := []struct {
+		name     string
+		quirks   Quirks
+		opcode   uint16
+		expected uint16
+	}{
+		{"dump increment", Quirks{}, 0xF355, 0x204},
+		{"dump unchanged", Quirks{LoadStore: true}, 0xF355, 0x200},
+		{"load increment", Quirks{}, 0xF365, 0x204},
+		{"load unchanged", Quirks{LoadStore: true}, 0xF365, 0x200},
+	}
+	for _, test := range tests {
+		go8 := Go8{}
+		go8.initialize()
+		go8.quirks = test.quirks
+		go8.opcode = test.opcode
+		go8.index = 0x200
+		if test.opcode&0x00FF == 0x55 {
+			go8.regDump()
+		} else {
+			go8.regLoad()
+		}
+		if go8.index != test.expected {
+			t.Errorf("%s: wrong index. Got %x, expected %x.", test.name, go8.index, test.expected)
+		}
+	}
+}
+
+func TestQuirkJump(t *testing.T) {
+	tests := []struct {
+		name     string
+		quirks   Quirks
+		expected int
+	}{
+		{"jump v0", Quirks{}, 0x123 + 0x4},
+		{"jump vx", Quirks{Jump: true}, 0x123 + 0x8},
+	}
+	for _, test := range tests {
+		go8 := Go8{}
+		go8.initialize()
+		go8.quirks = test.quirks
+		go8.opcode = 0xB123
+		go8.V[0] = 0x4
+		go8.V[1] = 0x8
+		go8.addJump()
+		checkPc(test.expected, go8.pc, t)
+	}
+}
+
+func TestQuirkVFReset(t *testing.T) {
+	tests := []struct {
+		name     string
+		quirks   Quirks
+		opcode   uint16
+		expected uint8
+	}{
+		{"or keep", Quirks{}, 0x8121, 0x5},
+		{"or reset", Quirks{VFReset: true}, 0x8121, 0x0},
+		{"and keep", Quirks{}, 0x8122, 0x5},
+		{"and reset", Quirks{VFReset: true}, 0x8122, 0x0},
+		{"xor keep", Quirks{}, 0x8123, 0x5},
+		{"xor reset", Quirks{VFReset: true}, 0x8123, 0x0},
+	}
+	for _, test := range tests {
+		go8 := Go8{}
+		go8.initialize()
+		go8.quirks = test.quirks
+		go8.opcode = test.opcode
+		go8.V[0xF] = 0x5
+		go8.execute(Decode(test.opcode))
+		if go8.V[0xF] != test.expected {
+			t.Errorf("%s: wrong value for V[0xF]. Got %x, expected %x.", test.name, go8.V[0xF], test.expected)
+		}
+	}
+}
+
+func TestQuirkClip(t *testing.T) {
+	tests := []struct {
+		name     string
+		quirks   Quirks
+		expected uint8
+	}{
+		{"wrap", Quirks{}, 1},
+		{"clip", Quirks{Clip: true}, 0},
+	}
+	for _, test := range tests {
+		go8 := Go8{}
+		go8.initialize()
+		go8.quirks = test.quirks
+		// draw a 2x2 block at the bottom right corner
+		go8.opcode = 0xD012
+		go8.V[0] = 63
+		go8.V[1] = 31
+		go8.memory[go8.index] = 0xC0
+		go8.memory[go8.index+1] = 0xC0
+		go8.draw()
+		if go8.gfx[63+31*64] != 1 {
+			t.Errorf("%s: origin pixel not drawn.", test.name)
+		}
+		if go8.gfx[0+31*64] != test.expected {
+			t.Errorf("%s: wrong horizontal wrap pixel. Got %d, expected %d.", test.name, go8.gfx[0+31*64], test.expected)
+		}
+		if go8.gfx[63] != test.expected {
+			t.Errorf("%s: wrong vertical wrap pixel. Got %d, expected %d.", test.name, go8.gfx[63], test.expected)
+		}
+		if go8.gfx[0] != test.expected {
+			t.Errorf("%s: wrong corner wrap pixel. Got %d, expected %d.", test.name, go8.gfx[0], test.expected)
+		}
+	}
+}
+
+func TestQuirkDisplayWait(t *testing.T) {
+	tests := []struct {
+		name     string
+		quirks   Quirks
+		expected int
+	}{
+		{"no wait", Quirks{}, 0x204},
+		{"wait", Quirks{DisplayWait: true}, 0x202},
+	}
+	for _, test := range tests {
+		go8 := Go8{}
+		go8.initialize()
+		go8.quirks = test.quirks
+		// draw, then set V0
+		go8.memory[0x200] = 0xD0
+		go8.memory[0x201] = 0x01
+		go8.memory[0x202] = 0x60
+		go8.memory[0x203] = 0x01
+		go8.memory[0x204] = 0x12
+		go8.memory[0x205] = 0x04
+		go8.emulateCycle()
+		go8.emulateCycle()
+		checkPc(test.expected, go8.pc, t)
+		go8.vblank()
+		go8.emulateCycle()
+		if go8.V[0] != 1 {
+			t.Errorf("%s: execution did not resume after vblank.", test.name)
+		}
+	}
+}
+
+func TestQuirkPresets(t *testing.T) {
+	for _, name := range []string{"vip", "chip48", "schip", "xochip"} {
+		if _, err := getQuirks(name); err != nil {
+			t.Errorf("Preset %s not found: %v", name, err)
+		}
+	}
+	if _, err := getQuirks("bogus"); err == nil {
+		t.Error("Expected error for unknown preset.")
+	}
+	quirks, _ := getQuirks("xochip")
+	if quirks != (Quirks{}) {
+		t.Errorf("XO-CHIP preset should be the zero value. Got %+v.", quirks)
+	}
 }
 
 func allFieldsInit(emu *Go8) bool {
 	return emu.opcode == 0 &&
-		allArrZero(emu.memory[0x50+80:]) && // fontset stored < 0x50
+		allArrZero(emu.memory[0xA0+160:]) && // fontsets stored < 0x140
 		allArrZero(emu.V[:]) &&
 		emu.index == 0 &&
 		emu.pc == 0x0200 &&
 		allArrZero(emu.gfx[:]) &&
+		emu.hires == false &&
+		emu.plane == 1 &&
 		emu.delayTimer == 0 &&
 		emu.soundTimer == 0 &&
 		allArrZero16(emu.stack[:]) &&
@@ -0,0 +1,42 @@
+package main
+
+import "fmt"
+
+// ErrorKind - the reason an instruction could not be executed
+type ErrorKind int
+
+// ErrorKind values
+const (
+	UnknownOpcode ErrorKind = iota
+	StackOverflow
+	StackUnderflow
+	MemoryOutOfBounds
+	ROMTooLarge
+)
+
+var errorKindNames = []string{
+	UnknownOpcode:     "unknown opcode",
+	StackOverflow:     "stack overflow",
+	StackUnderflow:    "stack underflow",
+	MemoryOutOfBounds: "memory out of bounds",
+	ROMTooLarge:       "ROM too large",
+}
+
+func (kind ErrorKind) String() string {
+	if kind < 0 || int(kind) >= len(errorKindNames) {
+		return fmt.Sprintf("ErrorKind(%d)", int(kind))
+	}
+	return errorKindNames[kind]
+}
+
+// ExecError - an error raised while executing the instruction at PC.
+// The machine state is left as it was before the instruction.
+type ExecError struct {
+	PC     uint16
+	Opcode uint16
+	Kind   ErrorKind
+}
+
+func (err *ExecError) Error() string {
+	return fmt.Sprintf("%v: pc %#04x, opcode %#04x", err.Kind, err.PC, err.Opcode)
+}
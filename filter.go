@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	defaultPersistence = 4
+	maxPersistence     = 60
+)
+
+// displayFilter - changes what is shown of the frame buffer, without
+// changing the machine state. The result is only valid until the next call.
+type displayFilter interface {
+	apply(gfx []uint8, w, h int) []uint8
+}
+
+// getFilter - the filter named name, nil for none. persistence is how
+// many frames pixels take to fade out with the phosphor filter.
+func getFilter(name string, persistence int) (displayFilter, error) {
+	switch name {
+	case "none":
+		return nil, nil
+	case "phosphor":
+		if persistence < 1 || persistence > maxPersistence {
+			return nil, fmt.Errorf("invalid persistence %d, expected 1 to %d frames", persistence, maxPersistence)
+		}
+		return &phosphorFilter{frames: persistence}, nil
+	case "or":
+		return &orFilter{}, nil
+	}
+	return nil, fmt.Errorf("unknown filter %q, expected none, phosphor or or", name)
+}
+
+// orFilter - shows a pixel if it was set in this frame or the last, so
+// sprites erased and redrawn over two frames stay visible
+type orFilter struct {
+	last []uint8
+	out  []uint8
+}
+
+func (filter *orFilter) apply(gfx []uint8, w, h int) []uint8 {
+	if len(filter.last) != len(gfx) {
+		filter.last = append([]uint8{}, gfx...)
+		filter.out = make([]uint8, len(gfx))
+		return gfx
+	}
+	for i, p := range gfx {
+		filter.out[i] = p | filter.last[i]
+	}
+	copy(filter.last, gfx)
+	return filter.out
+}
+
+// phosphorFilter - fades pixels that turn off towards the background over
+// frames frames, like the phosphor of a CRT
+type phosphorFilter struct {
+	frames int
+	// planes each pixel was last lit in, and frames since it turned off
+	planes []uint8
+	age    []uint8
+	out    []uint8
+}
+
+func (filter *phosphorFilter) apply(gfx []uint8, w, h int) []uint8 {
+	if len(filter.planes) != len(gfx) {
+		filter.planes = make([]uint8, len(gfx))
+		filter.age = make([]uint8, len(gfx))
+		filter.out = make([]uint8, len(gfx))
+	}
+	for i, p := range gfx {
+		switch {
+		case p&3 != 0:
+			filter.planes[i] = p & 3
+			filter.age[i] = 0
+			filter.out[i] = p & 3
+		case filter.planes[i] != 0 && int(filter.age[i]) < filter.frames:
+			filter.age[i]++
+			filter.out[i] = fadedPixel(filter.planes[i], float64(filter.age[i])/float64(filter.frames+1))
+		default:
+			filter.planes[i] = 0
+			filter.out[i] = 0
+		}
+	}
+	return filter.out
+}
+
+// fadedPixel - the display value of a pixel in planes faded towards the
+// background by fade, from 0 to 1
+func fadedPixel(planes uint8, fade float64) uint8 {
+	level := math.Max(1, math.Min(maxFade, math.Round(fade*(maxFade+1))))
+	return planes | uint8(level)<<2
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestGetFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		persistence int
+		valid       bool
+	}{
+		{"none", 0, true},
+		{"or", 0, true},
+		{"phosphor", 1, true},
+		{"phosphor", maxPersistence, true},
+		{"phosphor", 0, false},
+		{"phosphor", maxPersistence + 1, false},
+		{"blur", defaultPersistence, false},
+	}
+	for _, test := range tests {
+		filter, err := getFilter(test.name, test.persistence)
+		if (err == nil) != test.valid {
+			t.Errorf("%s %d: Wrong error. Got %v.", test.name, test.persistence, err)
+		}
+		if test.name == "none" && filter != nil {
+			t.Errorf("none: Wrong filter. Got %T, expected nil.", filter)
+		}
+	}
+}
+
+func TestOrFilter(t *testing.T) {
+	filter := &orFilter{}
+	frames := []struct {
+		gfx      []uint8
+		expected []uint8
+	}{
+		// the first frame has nothing to merge with
+		{[]uint8{1, 0, 0, 0}, []uint8{1, 0, 0, 0}},
+		{[]uint8{0, 2, 0, 0}, []uint8{1, 2, 0, 0}},
+		{[]uint8{0, 0, 3, 0}, []uint8{0, 2, 3, 0}},
+		{[]uint8{0, 0, 0, 0}, []uint8{0, 0, 3, 0}},
+		// a resolution change starts over
+		{[]uint8{0, 1}, []uint8{0, 1}},
+		{[]uint8{1, 0}, []uint8{1, 1}},
+	}
+	for i, frame := range frames {
+		out := filter.apply(frame.gfx, len(frame.gfx), 1)
+		if string(out) != string(frame.expected) {
+			t.Errorf("Frame %d: Wrong pixels. Got %v, expected %v.", i, out, frame.expected)
+		}
+	}
+}
+
+func TestPhosphorFilter(t *testing.T) {
+	const frames = 3
+	filter := &phosphorFilter{frames: frames}
+	if out := filter.apply([]uint8{2, 3}, 2, 1); out[0] != 2 || out[1] != 3 {
+		t.Errorf("Wrong lit pixels. Got %v, expected [2 3].", out)
+	}
+	last := uint8(0)
+	for i := 1; i <= frames; i++ {
+		out := filter.apply([]uint8{0, 3}, 2, 1)
+		if out[0]&3 != 2 {
+			t.Errorf("Frame %d: Wrong planes. Got %x, expected 2.", i, out[0]&3)
+		}
+		if out[0]>>2 <= last>>2 {
+			t.Errorf("Frame %d: Pixel not fading. Got %x after %x.", i, out[0], last)
+		}
+		if out[1] != 3 {
+			t.Errorf("Frame %d: Wrong lit pixel. Got %x, expected 3.", i, out[1])
+		}
+		last = out[0]
+	}
+	if out := filter.apply([]uint8{0, 3}, 2, 1); out[0] != 0 {
+		t.Errorf("Pixel not faded out. Got %x, expected 0.", out[0])
+	}
+	// a pixel lit again while fading is shown at full brightness
+	filter.apply([]uint8{1, 3}, 2, 1)
+	filter.apply([]uint8{0, 3}, 2, 1)
+	if out := filter.apply([]uint8{1, 3}, 2, 1); out[0] != 1 {
+		t.Errorf("Wrong relit pixel. Got %x, expected 1.", out[0])
+	}
+}
+
+func TestPaletteColor(t *testing.T) {
+	pal := palette{
+		{0x00, 0x00, 0x00, 0xFF},
+		{0xFF, 0x80, 0x40, 0xFF},
+		{0x00, 0xFF, 0x00, 0xFF},
+		{0x00, 0x00, 0xFF, 0xFF},
+	}
+	tests := []struct {
+		p        uint8
+		expected color.RGBA
+	}{
+		{0, pal[0]},
+		{1, pal[1]},
+		{3, pal[3]},
+		{fadedPixel(1, 0.5), color.RGBA{0x7F, 0x40, 0x20, 0xFF}},
+		{fadedPixel(2, 0.25), color.RGBA{0x00, 0xBF, 0x00, 0xFF}},
+	}
+	for _, test := range tests {
+		if c := pal.color(test.p); c != test.expected {
+			t.Errorf("Wrong colour of %x. Got %v, expected %v.", test.p, c, test.expected)
+		}
+	}
+	if colors := pal.colors(); len(colors) != 256 || colors[fadedPixel(1, 0.5)] != pal.color(fadedPixel(1, 0.5)) {
+		t.Errorf("Wrong colours for paletted images.")
+	}
+}
@@ -1,76 +1,113 @@
+//go:build !js
+// +build !js
+
 package main
 
 import (
 	"github.com/faiface/pixel"
 	"github.com/faiface/pixel/imdraw"
 	"github.com/faiface/pixel/pixelgl"
-	"golang.org/x/image/colornames"
 )
 
+// initial window size, and the least space left around the display in a
+// window; fullscreen the display goes to the edges
 const (
-	width       = 640 + 20
-	height      = 320 + 20
-	thickness   = 10
-	pixelSize   = 10
-	pixelWidth  = 64
-	pixelHeight = 32
+	width  = 640 + 20
+	height = 320 + 20
+	border = 10
 )
 
-var keymapping = map[uint8]pixelgl.Button{
-	0x1: pixelgl.Key1,
-	0x2: pixelgl.Key2,
-	0x3: pixelgl.Key3,
-	0xC: pixelgl.Key4,
-	0x4: pixelgl.KeyQ,
-	0x5: pixelgl.KeyW,
-	0x6: pixelgl.KeyE,
-	0xD: pixelgl.KeyR,
-	0x7: pixelgl.KeyA,
-	0x8: pixelgl.KeyS,
-	0x9: pixelgl.KeyD,
-	0xE: pixelgl.KeyF,
-	0xA: pixelgl.KeyZ,
-	0x0: pixelgl.KeyX,
-	0xB: pixelgl.KeyC,
-	0xF: pixelgl.KeyV,
-}
+const title = "GO8"
 
-// GraphicsDevice - a generic graphics device interface
-type GraphicsDevice interface {
-	updateWindow(gfx []uint8)
-	closed() bool
-	pressed(key int) bool
+// windowButtons - the keys a keymap can bind, by name
+var windowButtons = map[string]pixelgl.Button{
+	"0": pixelgl.Key0, "1": pixelgl.Key1, "2": pixelgl.Key2, "3": pixelgl.Key3, "4": pixelgl.Key4,
+	"5": pixelgl.Key5, "6": pixelgl.Key6, "7": pixelgl.Key7, "8": pixelgl.Key8, "9": pixelgl.Key9,
+	"A": pixelgl.KeyA, "B": pixelgl.KeyB, "C": pixelgl.KeyC, "D": pixelgl.KeyD, "E": pixelgl.KeyE,
+	"F": pixelgl.KeyF, "G": pixelgl.KeyG, "H": pixelgl.KeyH, "I": pixelgl.KeyI, "J": pixelgl.KeyJ,
+	"K": pixelgl.KeyK, "L": pixelgl.KeyL, "M": pixelgl.KeyM, "N": pixelgl.KeyN, "O": pixelgl.KeyO,
+	"P": pixelgl.KeyP, "Q": pixelgl.KeyQ, "R": pixelgl.KeyR, "S": pixelgl.KeyS, "T": pixelgl.KeyT,
+	"U": pixelgl.KeyU, "V": pixelgl.KeyV, "W": pixelgl.KeyW, "X": pixelgl.KeyX, "Y": pixelgl.KeyY, "Z": pixelgl.KeyZ,
+	"Space": pixelgl.KeySpace, "Enter": pixelgl.KeyEnter, "Tab": pixelgl.KeyTab,
+	"Up": pixelgl.KeyUp, "Down": pixelgl.KeyDown, "Left": pixelgl.KeyLeft, "Right": pixelgl.KeyRight,
+	"Comma": pixelgl.KeyComma, "Period": pixelgl.KeyPeriod, "Slash": pixelgl.KeySlash,
+	"Semicolon": pixelgl.KeySemicolon, "Minus": pixelgl.KeyMinus, "Equal": pixelgl.KeyEqual,
 }
 
 // Graphics - a pixel implementation of GraphicsDevice
 type Graphics struct {
 	window *pixelgl.Window
+	pal    palette
+	keymap keymap
+	// scale by whole window pixels only
+	integerScale bool
+	// pixel art scaling of the display, nil to draw it as it is
+	upscaler *upscaler
+	// window bounds to restore when leaving fullscreen
+	windowed pixel.Rect
 }
 
-func newGraphics() *Graphics {
+func newGraphics(pal palette, fullscreen, integerScale bool) *Graphics {
 	cfg := pixelgl.WindowConfig{
-		Title:  "GO8",
-		Bounds: pixel.R(0, 0, width, height),
+		Title:     title,
+		Bounds:    pixel.R(0, 0, width, height),
+		Resizable: true,
 	}
 	window, err := pixelgl.NewWindow(cfg)
 	check(err)
-	window.Clear(colornames.Black)
-	return &Graphics{window: window}
+	window.Clear(pal[0])
+	graphics := &Graphics{
+		window:       window,
+		pal:          pal,
+		keymap:       keymaps[defaultKeymap],
+		integerScale: integerScale,
+		windowed:     cfg.Bounds,
+	}
+	if fullscreen {
+		graphics.toggleFullscreen()
+	}
+	return graphics
 }
 
-func (graphics *Graphics) updateWindow(gfx []uint8) {
-	graphics.window.Clear(colornames.Black)
-	graphics.drawGfx(gfx[:])
+// toggleFullscreen - switches between a window and fullscreen on the
+// primary monitor
+func (graphics *Graphics) toggleFullscreen() {
+	if graphics.window.Monitor() != nil {
+		graphics.window.SetMonitor(nil)
+		graphics.window.SetBounds(graphics.windowed)
+		return
+	}
+	monitor := pixelgl.PrimaryMonitor()
+	if monitor == nil {
+		return
+	}
+	graphics.windowed = graphics.window.Bounds()
+	graphics.window.SetMonitor(monitor)
+}
+
+func (graphics *Graphics) updateWindow(gfx []uint8, w, h int) {
+	if graphics.upscaler != nil {
+		gfx, w, h = graphics.upscaler.apply(gfx, w, h)
+	}
+	graphics.window.Clear(graphics.pal[0])
+	graphics.drawGfx(gfx, w, h)
 	graphics.window.Update()
 }
 
-func (graphics *Graphics) drawGfx(gfx []uint8) {
+func (graphics *Graphics) drawGfx(gfx []uint8, w, h int) {
 	imd := imdraw.New(nil)
-	imd.Color = colornames.White
-	for y := 0; y < pixelHeight; y++ {
-		for x := 0; x < pixelWidth; x++ {
-			if gfx[x+y*pixelWidth] == 1 {
-				graphics.createPixel(imd, x, pixelHeight-y)
+	margin := float64(border)
+	if graphics.window.Monitor() != nil {
+		margin = 0
+	}
+	bounds := graphics.window.Bounds()
+	pixelSize, left, bottom := viewport(bounds.W(), bounds.H(), margin, w, h, graphics.integerScale)
+	origin := bounds.Min.Add(pixel.V(left, bottom))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if p := gfx[x+y*w]; p != 0 {
+				imd.Color = graphics.pal.color(p)
+				graphics.createPixel(imd, origin, x, h-1-y, pixelSize)
 			}
 		}
 	}
@@ -81,14 +118,52 @@ func (graphics *Graphics) closed() bool {
 	return graphics.window.Closed()
 }
 
-func (graphics *Graphics) pressed(button int) bool {
-	return graphics.window.Pressed(keymapping[uint8(button)])
+func (graphics *Graphics) pressed(key int) bool {
+	for _, name := range graphics.keymap[key] {
+		if graphics.window.Pressed(windowButtons[name]) {
+			return true
+		}
+	}
+	return false
+}
+
+// typedKey - the name of a bindable key that went down since the last
+// window update
+func (graphics *Graphics) typedKey() (string, bool) {
+	for name, button := range windowButtons {
+		if graphics.window.JustPressed(button) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func (graphics *Graphics) setTitle(text string) {
+	graphics.window.SetTitle(text)
+}
+
+// justPressed - whether button went down since the last window update
+func (graphics *Graphics) justPressed(button pixelgl.Button) bool {
+	return graphics.window.JustPressed(button)
+}
+
+// buttonDown - whether button is held down
+func (graphics *Graphics) buttonDown(button pixelgl.Button) bool {
+	return graphics.window.Pressed(button)
+}
+
+func (graphics *Graphics) shiftPressed() bool {
+	return graphics.buttonDown(pixelgl.KeyLeftShift) || graphics.buttonDown(pixelgl.KeyRightShift)
+}
+
+func (graphics *Graphics) ctrlPressed() bool {
+	return graphics.buttonDown(pixelgl.KeyLeftControl) || graphics.buttonDown(pixelgl.KeyRightControl)
 }
 
-func (graphics *Graphics) createPixel(imd *imdraw.IMDraw, xpos, ypos int) {
-	x := float64(pixelSize * xpos)
-	y := float64(pixelSize * ypos)
-	imd.Push(pixel.V(x, y))           // bottom left
-	imd.Push(pixel.V(x+pixelSize, y)) // bottom right
-	imd.Rectangle(thickness)
+func (graphics *Graphics) createPixel(imd *imdraw.IMDraw, origin pixel.Vec, xpos, ypos int, pixelSize float64) {
+	x := origin.X + pixelSize*float64(xpos)
+	y := origin.Y + pixelSize*float64(ypos)
+	imd.Push(pixel.V(x, y))                     // bottom left
+	imd.Push(pixel.V(x+pixelSize, y+pixelSize)) // top right
+	imd.Rectangle(0)
 }
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// nullGraphics - GraphicsDevice without a window, no key is ever pressed
+type nullGraphics struct{}
+
+func (nullGraphics) updateWindow(gfx []uint8, w, h int) {}
+
+func (nullGraphics) closed() bool {
+	return false
+}
+
+func (nullGraphics) pressed(key int) bool {
+	return false
+}
+
+// nullSound - SoundDevice without audio output
+type nullSound struct{}
+
+func (nullSound) start(gen generator) {}
+
+func (nullSound) stop() {}
+
+// keyEvent - the keys held from frame on, bit n for key n
+type keyEvent struct {
+	frame int
+	keys  uint16
+}
+
+// keyScript - scripted keypad input for headless runs. A script is a list
+// of FRAME:KEYS entries separated by spaces, commas or newlines; KEYS are
+// the hex digits of the keys held from that frame until the next entry,
+// empty to release them all. "60:5 62: 120:46" taps 5 for two frames at
+// frame 60 and holds 4 and 6 from frame 120 on.
+type keyScript struct {
+	events []keyEvent
+	// frames run so far and the index of the next event
+	frame int
+	next  int
+	held  uint16
+}
+
+func parseKeyScript(text string) (*keyScript, error) {
+	script := &keyScript{}
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	for _, field := range fields {
+		parts := strings.SplitN(field, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("keys: %q is not FRAME:KEYS", field)
+		}
+		frame, err := strconv.Atoi(parts[0])
+		if err != nil || frame < 0 {
+			return nil, fmt.Errorf("keys: invalid frame %q", parts[0])
+		}
+		if n := len(script.events); n > 0 && frame <= script.events[n-1].frame {
+			return nil, fmt.Errorf("keys: frame %d is not after frame %d", frame, script.events[n-1].frame)
+		}
+		event := keyEvent{frame: frame}
+		for _, digit := range parts[1] {
+			key, err := strconv.ParseUint(string(digit), 16, 4)
+			if err != nil {
+				return nil, fmt.Errorf("keys: invalid key %q at frame %d", digit, frame)
+			}
+			event.keys |= 1 << key
+		}
+		script.events = append(script.events, event)
+	}
+	return script, nil
+}
+
+// loadKeyScript - parses text as a script, or the file it names after @
+func loadKeyScript(text string) (*keyScript, error) {
+	if strings.HasPrefix(text, "@") {
+		data, err := ioutil.ReadFile(text[1:])
+		if err != nil {
+			return nil, err
+		}
+		text = string(data)
+	}
+	return parseKeyScript(text)
+}
+
+// keys - the keypad state of the next frame
+func (script *keyScript) keys() [16]uint8 {
+	for script.next < len(script.events) && script.events[script.next].frame <= script.frame {
+		script.held = script.events[script.next].keys
+		script.next++
+	}
+	script.frame++
+	return unpackKeys(script.held)
+}
+
+// printScreen - prints the display, one character per pixel: . when off,
+// # in plane 1, + in plane 2 and @ in both
+func printScreen(w io.Writer, emu *Go8) {
+	const pixels = ".#+@"
+	width, height := int(emu.width()), int(emu.height())
+	line := make([]byte, width)
+	for y := 0; y < height; y++ {
+		for x := range line {
+			line[x] = pixels[emu.gfx[y*width+x]&3]
+		}
+		fmt.Fprintf(w, "%s\n", line)
+	}
+}
+
+// runHeadless - runs the ROM in opts without a window or audio, as fast as
+// it goes, then prints the registers and screen to out. Returns the error
+// that stopped the ROM, if any.
+func runHeadless(opts options, out io.Writer) error {
+	emu := newGo8(nullSound{}, nullGraphics{}, opts.quirks, opts.random)
+	emu.cyclesPerFrame = opts.cyclesPerFrame
+	emu.frameRate = opts.frameRate
+	emu.filter = opts.filter
+	emu.tone = opts.tone
+	rom, err := ioutil.ReadFile(opts.rom)
+	if err != nil {
+		return err
+	}
+	if err := emu.loadROMData(rom); err != nil {
+		return err
+	}
+	var player *moviePlayer
+	switch {
+	case opts.keys != "" && opts.play != "":
+		return fmt.Errorf("-keys and -play both drive the keypad, use one of them")
+	case opts.keys != "":
+		script, err := loadKeyScript(opts.keys)
+		if err != nil {
+			return err
+		}
+		emu.keypad = script.keys
+	case opts.play != "":
+		m, err := loadMovie(opts.play)
+		if err != nil {
+			return err
+		}
+		if player, err = m.play(emu, rom); err != nil {
+			return err
+		}
+	}
+	var recorder *gifRecorder
+	if opts.gif != "" {
+		recorder = newGIFRecorder(emu.graphics, emu.framesPerSecond(), opts.scale, opts.palette)
+		emu.graphics = recorder
+	}
+	err = runFrames(emu, opts.frames, player)
+	printRegs(out, emu)
+	printScreen(out, emu)
+	if opts.screenshot != "" {
+		if captureErr := emu.screenshot(opts.screenshot, opts.scale, opts.palette); err == nil {
+			err = captureErr
+		}
+	}
+	if recorder != nil {
+		if recorder.full {
+			fmt.Fprintln(out, recorder.limitReached())
+		}
+		if captureErr := recorder.save(opts.gif); err == nil {
+			err = captureErr
+		}
+	}
+	return err
+}
+
+// headlessFrameLimit - the frames a headless run without -frames waits for
+// the ROM to exit, ten minutes of play, so a ROM that never exits cannot
+// hang a CI job
+const headlessFrameLimit = 10 * 60 * 60
+
+// runFrames - runs frames frames, or if frames is 0 until the movie ends if
+// one is playing or else until the ROM exits, failing if it has not after
+// headlessFrameLimit frames
+func runFrames(emu *Go8, frames int, player *moviePlayer) error {
+	for frame := 0; frames == 0 || frame < frames; frame++ {
+		if emu.exited || frames == 0 && player != nil && player.done() {
+			return nil
+		}
+		if frames == 0 && player == nil && frame == headlessFrameLimit {
+			return fmt.Errorf("headless: the ROM did not exit within %d frames, use -frames to run a fixed number",
+				headlessFrameLimit)
+		}
+		if err := emu.RunFrame(); err != nil {
+			return err
+		}
+		if player != nil {
+			if err := player.verify(emu); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testKeyProgram - counts in V1 the frames in which key 0 is down, one
+// loop per frame at three cycles per frame
+var testKeyProgram = []uint8{
+	0xE0, 0x9E, // 200: skip if key V0 down
+	0x12, 0x06, // 202: jump 206
+	0x71, 0x01, // 204: V1 += 1
+	0x12, 0x00, // 206: loop
+}
+
+func TestParseKeyScript(t *testing.T) {
+	script, err := parseKeyScript("2:0, 5:\n8:0A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []uint16{0, 0, 1, 1, 1, 0, 0, 0, 0x401, 0x401}
+	for frame, keys := range expected {
+		if got := packKeys(script.keys()); got != keys {
+			t.Errorf("Wrong keys at frame %d. Got %x, expected %x.", frame, got, keys)
+		}
+	}
+	tests := []struct {
+		script string
+		err    string
+	}{
+		{"12", "not FRAME:KEYS"},
+		{"x:1", "invalid frame"},
+		{"-1:1", "invalid frame"},
+		{"1:G", "invalid key"},
+		{"5:1 5:2", "not after frame 5"},
+	}
+	for _, test := range tests {
+		if _, err := parseKeyScript(test.script); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: Wrong error. Got %v, expected %s.", test.script, err, test.err)
+		}
+	}
+}
+
+func writeTestROM(t *testing.T, rom []uint8) string {
+	dir := writeTestFiles(t, map[string]string{"test.ch8": string(rom)})
+	return filepath.Join(dir, "test.ch8")
+}
+
+func TestRunHeadless(t *testing.T) {
+	rom := writeTestROM(t, testKeyProgram)
+	defer os.RemoveAll(filepath.Dir(rom))
+	var out bytes.Buffer
+	opts := options{rom: rom, cyclesPerFrame: 3, frames: 10, keys: "2:0 5: 8:0"}
+	if err := runHeadless(opts, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "V0=00 V1=05") {
+		t.Errorf("Wrong registers, expected V1=05. Got:\n%s", out.String())
+	}
+	if lines := strings.Count(out.String(), "\n"); lines != 4+screenHeight {
+		t.Errorf("Wrong number of lines. Got %d, expected %d.", lines, 4+screenHeight)
+	}
+}
+
+func TestRunHeadlessExit(t *testing.T) {
+	tests := []struct {
+		name string
+		rom  []uint8
+		err  string
+	}{
+		{"exit", []uint8{0x00, 0xFD}, ""},
+		{"error", []uint8{0x00, 0xEE}, StackUnderflow.String()},
+		{"no exit", []uint8{0x12, 0x00}, "did not exit within"},
+	}
+	for _, test := range tests {
+		rom := writeTestROM(t, test.rom)
+		var out bytes.Buffer
+		// runs until the ROM stops, however many frames that takes
+		err := runHeadless(options{rom: rom, cyclesPerFrame: 10}, &out)
+		os.RemoveAll(filepath.Dir(rom))
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: Wrong error. Got %v, expected %q.", test.name, err, test.err)
+		}
+		if !strings.Contains(out.String(), "PC=") {
+			t.Errorf("%s: Registers not printed. Got:\n%s", test.name, out.String())
+		}
+	}
+}
+
+func TestPrintScreen(t *testing.T) {
+	go8 := Go8{}
+	go8.initialize()
+	go8.gfx[0] = 1
+	go8.gfx[1] = 2
+	go8.gfx[screenWidth+2] = 3
+	var out bytes.Buffer
+	printScreen(&out, &go8)
+	lines := strings.Split(out.String(), "\n")
+	if lines[0] != "#+"+strings.Repeat(".", screenWidth-2) {
+		t.Errorf("Wrong first line. Got %s.", lines[0])
+	}
+	if lines[1] != "..@"+strings.Repeat(".", screenWidth-3) {
+		t.Errorf("Wrong second line. Got %s.", lines[1])
+	}
+}
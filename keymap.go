@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// keymap - the keyboard keys that press each keypad key, by name
+type keymap [16][]string
+
+// keyNames - the keyboard keys a keymap can bind. The window and the
+// browser go by the position of a key on a US layout, the terminal by the
+// character it types.
+var keyNames = append(strings.Split("0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ", ""),
+	"Space", "Enter", "Tab", "Up", "Down", "Left", "Right",
+	"Comma", "Period", "Slash", "Semicolon", "Minus", "Equal")
+
+// keyBlock - the keys the keypad layouts are laid out on, row by row
+const keyBlock = "1234QWERASDFZXCV"
+
+// the keypads of the COSMAC VIP and DREAM 6800, row by row
+const (
+	vipLayout       = "123C456D789EA0BF"
+	dream6800Layout = "0123456789ABCDEF"
+)
+
+// keymaps - the presets. arrows adds the arrow keys and space on the keys
+// many games move and fire with.
+var keymaps = map[string]keymap{
+	"vip":       layoutKeymap(vipLayout, nil),
+	"dream6800": layoutKeymap(dream6800Layout, nil),
+	"arrows":    layoutKeymap(vipLayout, map[int]string{0x2: "Up", 0x4: "Left", 0x5: "Space", 0x6: "Right", 0x8: "Down"}),
+}
+
+const defaultKeymap = "vip"
+
+// keypadOrder - the keypad keys as they are laid out on the COSMAC VIP,
+// the order they are bound in
+var keypadOrder = []int{0x1, 0x2, 0x3, 0xC, 0x4, 0x5, 0x6, 0xD, 0x7, 0x8, 0x9, 0xE, 0xA, 0x0, 0xB, 0xF}
+
+// layoutKeymap - a keymap putting the keypad layout on keyBlock, plus the
+// extra keys
+func layoutKeymap(layout string, extra map[int]string) keymap {
+	var km keymap
+	for i, c := range layout {
+		key, _ := strconv.ParseUint(string(c), 16, 8)
+		km[key] = append(km[key], string(keyBlock[i]))
+	}
+	for key, name := range extra {
+		km[key] = append(km[key], name)
+	}
+	return km
+}
+
+// getKeymap - the preset named name
+func getKeymap(name string) (keymap, error) {
+	km, ok := keymaps[name]
+	if !ok {
+		var names []string
+		for name := range keymaps {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return keymap{}, fmt.Errorf("unknown keymap %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+	return km.clone(), nil
+}
+
+func (km keymap) clone() keymap {
+	var c keymap
+	for key, names := range km {
+		c[key] = append([]string{}, names...)
+	}
+	return c
+}
+
+// bindings - the keypad keys each keyboard key presses
+func (km keymap) bindings() map[string][]int {
+	bindings := map[string][]int{}
+	for key, names := range km {
+		for _, name := range names {
+			bindings[name] = append(bindings[name], key)
+		}
+	}
+	return bindings
+}
+
+// keyName - the name in keyNames matching name in any case
+func keyName(name string) (string, bool) {
+	for _, n := range keyNames {
+		if strings.EqualFold(n, name) {
+			return n, true
+		}
+	}
+	return "", false
+}
+
+// set - applies a keymap file setting: preset = name replaces the whole
+// keymap, a keypad key in hex binds it to a space separated list of keys
+func (km *keymap) set(name, value string) error {
+	if name == "preset" {
+		preset, err := getKeymap(value)
+		if err != nil {
+			return err
+		}
+		*km = preset
+		return nil
+	}
+	key, err := strconv.ParseUint(name, 16, 8)
+	if err != nil || key > 0xF {
+		return fmt.Errorf("unknown setting %q, expected preset or a keypad key 0 to F", name)
+	}
+	var names []string
+	for _, n := range strings.Fields(value) {
+		name, ok := keyName(n)
+		if !ok {
+			return fmt.Errorf("unknown key %q, expected one of %s", n, strings.Join(keyNames, " "))
+		}
+		names = append(names, name)
+	}
+	km[key] = names
+	return nil
+}
+
+// defaultKeymapPath - the keymap file next to the config file
+func defaultKeymapPath() string {
+	path := defaultConfigPath()
+	if path == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(path), "keymap")
+}
+
+// romHash - identifies a ROM in the keymap file
+func romHash(rom []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(rom))
+}
+
+// loadKeymap - the keymap for rom. It starts from the preset, or without
+// one from the keymap file's settings for all ROMs, and applies the
+// settings in the file's [hash] section for rom over it. The file has
+// name = value lines like the config file; a missing file is not an error.
+func loadKeymap(filename, preset string, rom []byte) (keymap, error) {
+	name := preset
+	if name == "" {
+		name = defaultKeymap
+	}
+	km, err := getKeymap(name)
+	if err != nil || filename == "" {
+		return km, err
+	}
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return km, nil
+	}
+	if err != nil {
+		return km, err
+	}
+	defer f.Close()
+	section := ""
+	hash := romHash(rom)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			section = strings.ToLower(strings.TrimSpace(text[1 : len(text)-1]))
+			continue
+		}
+		parts := strings.SplitN(text, "=", 2)
+		if len(parts) != 2 {
+			return km, fmt.Errorf("%s:%d: expected name = value", filename, line)
+		}
+		if (section == "" && preset != "") || (section != "" && (rom == nil || section != hash)) {
+			continue
+		}
+		if err := km.set(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])); err != nil {
+			return km, fmt.Errorf("%s:%d: %v", filename, line, err)
+		}
+	}
+	return km, scanner.Err()
+}
+
+// saveROMKeymap - writes km to the keymap file as the section for rom,
+// replacing the one there. The rest of the file is kept as it is.
+func saveROMKeymap(filename string, rom []byte, romName string, km keymap) error {
+	if filename == "" {
+		return fmt.Errorf("no keymap file to save to")
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	header := "[" + romHash(rom) + "]"
+	var lines []string
+	inSection := false
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		text := strings.TrimSpace(line)
+		if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			inSection = strings.EqualFold(text, header)
+		}
+		if !inSection {
+			lines = append(lines, line)
+		}
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > 0 {
+		lines = append(lines, "")
+	}
+	lines = append(lines, header, "# "+romName)
+	for key, names := range km {
+		lines = append(lines, strings.TrimSpace(fmt.Sprintf("%X = %s", key, strings.Join(names, " "))))
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// keyBinder - rebinds the keypad keys in keypadOrder, each to the next
+// keyboard key pressed
+type keyBinder struct {
+	km   keymap
+	next int
+}
+
+func newKeyBinder(km keymap) *keyBinder {
+	return &keyBinder{km: km.clone()}
+}
+
+// key - the keypad key waiting to be bound
+func (binder *keyBinder) key() int {
+	return keypadOrder[binder.next]
+}
+
+func (binder *keyBinder) done() bool {
+	return binder.next == len(keypadOrder)
+}
+
+// bind - binds the keyboard key name to the waiting keypad key only,
+// taking it from any other keypad key
+func (binder *keyBinder) bind(name string) {
+	for key, names := range binder.km {
+		var kept []string
+		for _, n := range names {
+			if n != name {
+				kept = append(kept, n)
+			}
+		}
+		binder.km[key] = kept
+	}
+	binder.km[binder.key()] = []string{name}
+	binder.next++
+}
+
+// skip - keeps the waiting keypad key's binding
+func (binder *keyBinder) skip() {
+	binder.next++
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKeymapPresets(t *testing.T) {
+	tests := []struct {
+		preset string
+		name   string
+		key    int
+	}{
+		{"vip", "1", 0x1},
+		{"vip", "4", 0xC},
+		{"vip", "X", 0x0},
+		{"vip", "V", 0xF},
+		{"dream6800", "1", 0x0},
+		{"dream6800", "4", 0x3},
+		{"dream6800", "X", 0xD},
+		{"dream6800", "V", 0xF},
+		{"arrows", "W", 0x5},
+		{"arrows", "Up", 0x2},
+		{"arrows", "Left", 0x4},
+		{"arrows", "Right", 0x6},
+		{"arrows", "Down", 0x8},
+		{"arrows", "Space", 0x5},
+	}
+	for _, test := range tests {
+		km, err := getKeymap(test.preset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if keys := km.bindings()[test.name]; len(keys) != 1 || keys[0] != test.key {
+			t.Errorf("%s: Wrong keys for %s. Got %v, expected [%d].", test.preset, test.name, keys, test.key)
+		}
+	}
+	for name, km := range keymaps {
+		for key, names := range km {
+			if len(names) == 0 {
+				t.Errorf("%s: Key %X not bound.", name, key)
+			}
+			for _, n := range names {
+				if _, ok := keyName(n); !ok {
+					t.Errorf("%s: Unknown key name %q.", name, n)
+				}
+			}
+		}
+	}
+	if _, err := getKeymap("azerty"); err == nil {
+		t.Error("Expected an error for an unknown preset.")
+	}
+}
+
+func writeKeymapFile(t *testing.T, text string) string {
+	dir, err := ioutil.TempDir("", "keymap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	filename := filepath.Join(dir, "keymap")
+	if text != "" {
+		if err := ioutil.WriteFile(filename, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filename
+}
+
+func TestLoadKeymap(t *testing.T) {
+	rom := []byte{0x12, 0x00}
+	other := []byte{0x00, 0xE0}
+	filename := writeKeymapFile(t, `# keys for every ROM
+preset = dream6800
+5 = w up
+
+[`+strings.ToUpper(romHash(rom))+`]
+# test.ch8
+6 = Space
+F =
+`)
+	tests := []struct {
+		name   string
+		preset string
+		rom    []byte
+		// expected keys of keypad keys 5, 6 and F
+		key5, key6, keyF []string
+	}{
+		{"all ROMs", "", other, []string{"W", "Up"}, []string{"E"}, []string{"V"}},
+		{"no ROM", "", nil, []string{"W", "Up"}, []string{"E"}, []string{"V"}},
+		{"ROM override", "", rom, []string{"W", "Up"}, []string{"Space"}, nil},
+		// a preset replaces the keys for all ROMs, not those of the ROM
+		{"preset", "vip", other, []string{"W"}, []string{"E"}, []string{"V"}},
+		{"preset and ROM", "vip", rom, []string{"W"}, []string{"Space"}, nil},
+	}
+	for _, test := range tests {
+		km, err := loadKeymap(filename, test.preset, test.rom)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		got := [][]string{km[0x5], km[0x6], km[0xF]}
+		expected := [][]string{test.key5, test.key6, test.keyF}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: Wrong keys for 5, 6 and F. Got %q, expected %q.", test.name, got, expected)
+		}
+	}
+
+	km, err := loadKeymap(filepath.Join(filepath.Dir(filename), "missing"), "", rom)
+	if err != nil || !reflect.DeepEqual(km, keymaps[defaultKeymap]) {
+		t.Errorf("Missing file: Wrong keymap. Got %v, %v.", km, err)
+	}
+	for _, text := range []string{"5 = Hyper", "G = W", "preset = azerty", "5"} {
+		if _, err := loadKeymap(writeKeymapFile(t, text), "", rom); err == nil {
+			t.Errorf("%q: Expected an error.", text)
+		}
+	}
+}
+
+func TestSaveROMKeymap(t *testing.T) {
+	rom := []byte{0x12, 0x00}
+	other := []byte{0x00, 0xE0}
+	filename := writeKeymapFile(t, "# mine\n5 = Up\n")
+	km := keymaps["arrows"].clone()
+	km[0x3] = nil
+	if err := saveROMKeymap(filename, rom, "test.ch8", km); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveROMKeymap(filename, other, "other.ch8", keymaps["dream6800"]); err != nil {
+		t.Fatal(err)
+	}
+	// saving again replaces the section
+	km[0x3] = []string{"Tab"}
+	if err := saveROMKeymap(filename, rom, "test.ch8", km); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(data)
+	if !strings.HasPrefix(text, "# mine\n5 = Up\n\n") || strings.Count(text, romHash(rom)) != 1 {
+		t.Errorf("Wrong keymap file. Got\n%s", text)
+	}
+	for _, test := range []struct {
+		rom      []byte
+		expected keymap
+	}{{rom, km}, {other, keymaps["dream6800"]}} {
+		loaded, err := loadKeymap(filename, "", test.rom)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(loaded, test.expected) {
+			t.Errorf("Wrong saved keymap. Got %v, expected %v.", loaded, test.expected)
+		}
+	}
+}
+
+func TestKeyBinder(t *testing.T) {
+	binder := newKeyBinder(keymaps["arrows"])
+	if binder.key() != 0x1 {
+		t.Errorf("Wrong first key. Got %X, expected 1.", binder.key())
+	}
+	binder.bind("Up")
+	binder.skip()
+	binder.bind("1")
+	for !binder.done() {
+		binder.skip()
+	}
+	expected := keymaps["arrows"].clone()
+	expected[0x1] = []string{"Up"}
+	expected[0x2] = []string{"2"}
+	expected[0x3] = []string{"1"}
+	if !reflect.DeepEqual(binder.km, expected) {
+		t.Errorf("Wrong bindings. Got %v, expected %v.", binder.km, expected)
+	}
+	if len(keymaps["arrows"][0x1]) != 1 || keymaps["arrows"][0x1][0] != "1" {
+		t.Errorf("Binding changed the preset. Got %v.", keymaps["arrows"][0x1])
+	}
+}
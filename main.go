@@ -1,44 +1,349 @@
+//go:build !js
+// +build !js
+
 package main
 
 import (
-	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/faiface/pixel/pixelgl"
 )
 
-func run() {
-	rom, timerFreq, clockFreq := getFlags()
-	go8 := newGo8(newSound("sound/beep.wav"), newGraphics())
-	go8.loadROM(rom)
-	timerChan := time.NewTicker(timerFreq).C
-	cycleChan := time.NewTicker(clockFreq).C
-
-	for !go8.graphics.closed() {
-		select {
-		case <-cycleChan:
-			go8.emulateCycle()
-			if go8.drawFlag {
-				go8.updateWindow()
-				go8.drawFlag = false
+func run(opts options) {
+	// with a DAP client on stdio the ROM comes from the launch request, and
+	// only the keys for all ROMs apply
+	var rom []byte
+	if !opts.dapStdio {
+		var err error
+		if rom, err = ioutil.ReadFile(opts.rom); err != nil {
+			log.Fatal(err)
+		}
+	}
+	km, err := loadKeymap(opts.keymapFile, opts.keymap, rom)
+	check(err)
+	var go8 *Go8
+	// the window, nil with the terminal backend which has no hotkeys
+	var window *Graphics
+	var term *Terminal
+	if opts.backend == "terminal" {
+		if opts.debug || opts.dapStdio {
+			log.Fatal("the terminal backend needs stdin and stdout for itself, debug with -dap addr instead")
+		}
+		term, err = openTerminal()
+		check(err)
+		term.pal = opts.palette
+		term.release = opts.keyRelease
+		term.setKeymap(km)
+		defer term.close()
+		// audio would play on the machine the terminal is connected to
+		go8 = newGo8(nullSound{}, term, opts.quirks, opts.random)
+	} else {
+		window = newGraphics(opts.palette, opts.fullscreen, opts.integerScale)
+		window.upscaler = opts.upscaler
+		window.keymap = km
+		var sound SoundDevice = nullSound{}
+		if s, err := newSound(); err != nil {
+			log.Printf("sound disabled: %v", err)
+		} else {
+			sound = s
+		}
+		go8 = newGo8(sound, window, opts.quirks, opts.random)
+	}
+	go8.tone = opts.tone
+	go8.filter = opts.filter
+	go8.cyclesPerFrame = opts.cyclesPerFrame
+	go8.frameRate = opts.frameRate
+	if !opts.dapStdio {
+		if err := go8.loadROMData(rom); err != nil {
+			log.Fatal(err)
+		}
+	}
+	var dbg debugFrontend
+	var dap *dapServer
+	switch {
+	case opts.debug:
+		dbg = newDebugger(go8, readLines(os.Stdin), os.Stdout)
+	case opts.dapStdio:
+		dap = newDAPServer(go8)
+		dap.paused = true
+		dap.terminate = true
+		go dap.serve(os.Stdin, os.Stdout)
+		dbg = dap
+	case opts.dapAddr != "":
+		dap = newDAPServer(go8)
+		dap.program = opts.rom
+		check(dap.listen(opts.dapAddr))
+		dbg = dap
+	}
+	if dbg != nil {
+		go8.beforeCycle = dbg.beforeCycle
+	}
+	var rec *movie
+	var player *moviePlayer
+	if opts.record != "" || opts.play != "" {
+		if opts.dapStdio {
+			log.Fatal("movies need the ROM on the command line, not from the debug adapter")
+		}
+		if opts.record != "" {
+			rec = newMovie(go8, rom)
+		} else {
+			m, err := loadMovie(opts.play)
+			check(err)
+			player, err = m.play(go8, rom)
+			check(err)
+		}
+	}
+	// going back in time would break a movie
+	movieActive := rec != nil || player != nil
+	var rw *rewinder
+	if opts.rewindBudget > 0 && !movieActive {
+		rw = newRewinder(opts.rewindBudget)
+	}
+	// rebinding keys, which pauses the emulator
+	var binder *keyBinder
+	// a movie plays back at the frame rate it was recorded at
+	frameChan := time.NewTicker(time.Second / time.Duration(go8.framesPerSecond())).C
+
+	for !go8.graphics.closed() && !go8.exited {
+		<-frameChan
+		if binder != nil {
+			go8.updateWindow()
+			if bindKeys(binder, window) {
+				window.keymap = binder.km
+				binder = nil
+				saveKeymap(window.keymap, opts, rom)
+				go8.updateSound()
 			}
-			go8.setKeys()
-		case <-timerChan:
-			go8.updateTimers()
+			continue
+		}
+		if rw != nil && window != nil && window.buttonDown(rewindKey) {
+			rw.rewind(go8)
+			go8.updateWindow()
+			continue
+		}
+		err = go8.RunFrame()
+		if err != nil && dbg != nil && err != errQuit {
+			// let the user inspect the failed instruction
+			err = dbg.report(err)
+		}
+		if err != nil {
+			break
+		}
+		if rw != nil {
+			rw.record(go8)
+		}
+		if rec != nil {
+			rec.record(go8)
+		}
+		if player != nil {
+			if err := player.verify(go8); err != nil {
+				log.Print(err)
+			}
+			if player.done() {
+				log.Print("movie finished")
+				go8.keypad = nil
+				player = nil
+			}
+		}
+		if window != nil && !opts.dapStdio {
+			handleHotkeys(go8, window, opts, !movieActive)
+			if window.ctrlPressed() && window.justPressed(bindKey) {
+				go8.sound.stop()
+				binder = newKeyBinder(window.keymap)
+				promptBinding(binder, window)
+			}
+		}
+	}
+	if recorder, ok := go8.graphics.(*gifRecorder); ok {
+		stopGIF(go8, recorder, opts.rom)
+	}
+	if rec != nil {
+		if err := saveMovie(rec, opts.record); err != nil {
+			log.Printf("saving movie: %v", err)
 		}
 	}
+	if term != nil {
+		// log.Fatal skips deferred calls
+		term.close()
+	}
+	if err == errQuit {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if dap != nil {
+		dap.exit()
+	}
 }
 
-func getFlags() (string, time.Duration, time.Duration) {
-	rom := flag.String("rom", "roms/tetris.ch8", "Path to rom.")
-	timerFreq := flag.Int("timerFreq", 60, "Timer frequency in Hz.")
-	clockFreq := flag.Int("clockFreq", 300, "Clock speed in Hz.")
-	flag.Parse()
-	t := time.Duration((int(time.Second) / *timerFreq))
-	c := time.Duration((int(time.Second) / *clockFreq))
-	return *rom, t, c
+// held to play the game backwards
+const rewindKey = pixelgl.KeyBackspace
+
+var slotKeys = []pixelgl.Button{
+	pixelgl.KeyF1, pixelgl.KeyF2, pixelgl.KeyF3,
+	pixelgl.KeyF4, pixelgl.KeyF5, pixelgl.KeyF6,
+	pixelgl.KeyF7, pixelgl.KeyF8, pixelgl.KeyF9,
+}
+
+// F12 saves a screenshot, F10 starts and stops recording a GIF, F11
+// switches fullscreen on and off
+const (
+	screenshotKey = pixelgl.KeyF12
+	gifKey        = pixelgl.KeyF10
+	fullscreenKey = pixelgl.KeyF11
+)
+
+// handleHotkeys - F1-F9 load a save slot, shift+F1-F9 save to it, the
+// capture keys save images next to the ROM and F11 toggles fullscreen
+func handleHotkeys(go8 *Go8, graphics *Graphics, opts options, canLoad bool) {
+	rom := opts.rom
+	if graphics.justPressed(fullscreenKey) {
+		graphics.toggleFullscreen()
+	}
+	if graphics.justPressed(screenshotKey) {
+		filename := capturePath(rom, ".png")
+		if err := go8.screenshot(filename, opts.scale, opts.palette); err != nil {
+			log.Printf("saving screenshot: %v", err)
+		} else {
+			log.Printf("saved screenshot to %s", filename)
+		}
+	}
+	if recorder, ok := go8.graphics.(*gifRecorder); ok && recorder.full {
+		log.Print(recorder.limitReached())
+		stopGIF(go8, recorder, rom)
+	}
+	if graphics.justPressed(gifKey) {
+		if recorder, ok := go8.graphics.(*gifRecorder); ok {
+			stopGIF(go8, recorder, rom)
+		} else {
+			go8.graphics = newGIFRecorder(go8.graphics, go8.framesPerSecond(), opts.scale, opts.palette)
+			log.Print("recording GIF")
+		}
+	}
+	for i, key := range slotKeys[:stateSlots] {
+		if !graphics.justPressed(key) {
+			continue
+		}
+		slot := i + 1
+		filename := slotPath(rom, slot)
+		if graphics.shiftPressed() {
+			if err := go8.saveSlot(filename); err != nil {
+				log.Printf("saving slot %d: %v", slot, err)
+			} else {
+				log.Printf("saved slot %d to %s", slot, filename)
+			}
+		} else if !canLoad {
+			log.Printf("cannot load slot %d while a movie is recording or playing", slot)
+		} else if err := go8.loadSlot(filename); err != nil {
+			log.Printf("loading slot %d: %v", slot, err)
+		} else {
+			log.Printf("loaded slot %d", slot)
+		}
+	}
+}
+
+// stopGIF - stops recording and saves the GIF next to the ROM
+func stopGIF(go8 *Go8, recorder *gifRecorder, rom string) {
+	go8.graphics = recorder.GraphicsDevice
+	filename := capturePath(rom, ".gif")
+	if err := recorder.save(filename); err != nil {
+		log.Printf("saving GIF: %v", err)
+	} else {
+		log.Printf("saved GIF to %s", filename)
+	}
+}
+
+// commands - subcommands, go-8 without one runs the emulator
+var commands = map[string]func(args []string) error{
+	"asm":    asmCommand,
+	"dap":    dapCommand,
+	"disasm": disasmCommand,
+	"run":    runCommand,
+}
+
+// dapCommand - go-8 dap [flags]: debugs the program named by the client's
+// launch request, speaking the Debug Adapter Protocol on stdin and stdout
+func dapCommand(args []string) error {
+	opts := getFlags(args)
+	opts.dapStdio = true
+	pixelgl.Run(func() { run(opts) })
+	return nil
+}
+
+// runCommand - go-8 run [flags] [rom]: the emulator in a window or the
+// terminal, or with -headless a run without a window or audio for testing
+// ROMs on machines without a display
+func runCommand(args []string) error {
+	opts := getFlags(args)
+	if opts.headless {
+		return runHeadless(opts, os.Stdout)
+	}
+	if opts.backend == "terminal" {
+		run(opts)
+		return nil
+	}
+	pixelgl.Run(func() { run(opts) })
+	return nil
 }
 
 func main() {
-	pixelgl.Run(run)
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+	if err := runCommand(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// ctrl+K starts binding the keypad keys to the keys pressed next
+const bindKey = pixelgl.KeyK
+
+// promptBinding - asks for the key of the keypad key waiting to be bound in
+// the window title
+func promptBinding(binder *keyBinder, window *Graphics) {
+	key := binder.key()
+	current := strings.Join(binder.km[key], " ")
+	if current == "" {
+		current = "no key"
+	}
+	window.setTitle(fmt.Sprintf("%s - press the key for %X, Esc keeps %s", title, key, current))
+}
+
+// bindKeys - binds the waiting keypad key to the key pressed in the
+// window, or keeps its keys on Esc. Returns whether every key is bound.
+func bindKeys(binder *keyBinder, window *Graphics) bool {
+	if window.justPressed(pixelgl.KeyEscape) {
+		binder.skip()
+	} else if name, ok := window.typedKey(); ok {
+		binder.bind(name)
+	} else {
+		return false
+	}
+	if binder.done() {
+		window.setTitle(title)
+		return true
+	}
+	promptBinding(binder, window)
+	return false
+}
+
+// saveKeymap - saves the keys bound in the window as the ROM's own keys
+func saveKeymap(km keymap, opts options, rom []byte) {
+	if err := saveROMKeymap(opts.keymapFile, rom, filepath.Base(opts.rom), km); err != nil {
+		log.Printf("saving keymap: %v", err)
+	} else {
+		log.Printf("saved the keys for %s to %s", opts.rom, opts.keymapFile)
+	}
 }
@@ -0,0 +1,82 @@
+package main
+
+import "syscall/js"
+
+// ms per frame at 60 frames per second
+const frameMillis = 1000.0 / 60
+
+// main - the emulator in a web page. web/go8.js loads the module and calls
+// go8Start(rom, quirks, palette, keymap) with the ROM as a Uint8Array; errors are
+// passed to the page's go8Error function.
+func main() {
+	document := js.Global().Get("document")
+	canvas := newCanvas(document.Call("getElementById", "screen"))
+	sound := newWebAudio()
+	var go8 *Go8
+
+	js.Global().Set("go8Start", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if go8 != nil {
+			go8.sound.stop()
+		}
+		go8 = nil
+		quirksName := "xochip"
+		if len(args) > 1 && args[1].Type() == js.TypeString {
+			quirksName = args[1].String()
+		}
+		quirks, err := getQuirks(quirksName)
+		if err != nil {
+			return err.Error()
+		}
+		pal := defaultPalette
+		if len(args) > 2 && args[2].Type() == js.TypeString {
+			if pal, err = getPalette(args[2].String()); err != nil {
+				return err.Error()
+			}
+		}
+		canvas.pal = pal
+		km := keymaps[defaultKeymap]
+		if len(args) > 3 && args[3].Type() == js.TypeString {
+			if km, err = getKeymap(args[3].String()); err != nil {
+				return err.Error()
+			}
+		}
+		canvas.keymap = km
+		rom := make([]byte, args[0].Get("length").Int())
+		js.CopyBytesToGo(rom, args[0])
+		emu := newGo8(sound, canvas, quirks, nil)
+		if err := emu.loadROMData(rom); err != nil {
+			return err.Error()
+		}
+		go8 = emu
+		return nil
+	}))
+
+	// animation frames come at the display's refresh rate, the emulator
+	// runs the frames due since the last one
+	var last float64
+	var loop js.Func
+	loop = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		now := args[0].Float()
+		// don't catch up after the tab was in the background
+		if now-last > 250 {
+			last = now
+		}
+		for ; go8 != nil && now-last >= frameMillis; last += frameMillis {
+			if err := go8.RunFrame(); err != nil {
+				js.Global().Call("go8Error", err.Error())
+				go8.sound.stop()
+				go8 = nil
+			} else if go8.exited {
+				go8.sound.stop()
+				go8 = nil
+			}
+		}
+		if go8 == nil {
+			last = now
+		}
+		js.Global().Call("requestAnimationFrame", loop)
+		return nil
+	})
+	js.Global().Call("requestAnimationFrame", loop)
+	select {}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Movie files are a magic header and version, the ROM hash and settings
+// the recording started with, the keypad state of every frame and a
+// checksum of the machine state every movieChecksumInterval frames, all
+// big-endian.
+const (
+	movieMagic            = "GO8M"
+	movieVersion          = 2
+	movieChecksumInterval = 60
+	// a day at 60 frames per second, guards against corrupt frame counts
+	maxMovieFrames = 24 * 60 * 60 * 60
+)
+
+var errMovieMagic = errors.New("movie: not a go-8 movie")
+
+type movieHeader struct {
+	Magic   [4]byte
+	Version uint16
+}
+
+// movieSettingsV1 - what a version 1 recording started with
+type movieSettingsV1 struct {
+	ROMHash        [sha256.Size]byte
+	Seed           uint64
+	Quirks         uint8
+	CyclesPerFrame uint16
+}
+
+// movieSettingsV2 - version 2 adds the frame rate, 0 for timerRate
+type movieSettingsV2 struct {
+	movieSettingsV1
+	FrameRate uint16
+}
+
+// movieChecksum - CRC-32 of the machine state after Frame frames
+type movieChecksum struct {
+	Frame uint32
+	CRC   uint32
+}
+
+// movie - the input of a run, from which it can be replayed exactly
+type movie struct {
+	romHash        [sha256.Size]byte
+	seed           uint64
+	quirks         Quirks
+	cyclesPerFrame int
+	frameRate      int
+	// keypad state of each frame, bit n for key n
+	keys      []uint16
+	checksums []movieChecksum
+}
+
+// newMovie - starts recording emu, which has just loaded rom
+func newMovie(emu *Go8, rom []byte) *movie {
+	return &movie{
+		romHash:        sha256.Sum256(rom),
+		seed:           emu.RandomState(),
+		quirks:         emu.quirks,
+		cyclesPerFrame: emu.cyclesPerFrame,
+		frameRate:      emu.frameRate,
+	}
+}
+
+func stateChecksum(emu *Go8) uint32 {
+	return crc32.ChecksumIEEE(emu.encodeState())
+}
+
+func packKeys(key [16]uint8) uint16 {
+	var keys uint16
+	for i, down := range key {
+		if down != 0 {
+			keys |= 1 << uint(i)
+		}
+	}
+	return keys
+}
+
+func unpackKeys(keys uint16) [16]uint8 {
+	var key [16]uint8
+	for i := range key {
+		key[i] = uint8(keys >> uint(i) & 1)
+	}
+	return key
+}
+
+// record - adds the frame emu just ran
+func (m *movie) record(emu *Go8) {
+	m.keys = append(m.keys, packKeys(emu.key))
+	if frame := len(m.keys); frame%movieChecksumInterval == 0 {
+		m.checksums = append(m.checksums, movieChecksum{uint32(frame), stateChecksum(emu)})
+	}
+}
+
+func (m *movie) write(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	header := movieHeader{Version: movieVersion}
+	copy(header.Magic[:], movieMagic)
+	binary.Write(out, binary.BigEndian, header)
+	binary.Write(out, binary.BigEndian, movieSettingsV2{
+		movieSettingsV1: movieSettingsV1{
+			ROMHash:        m.romHash,
+			Seed:           m.seed,
+			Quirks:         quirkBits(m.quirks),
+			CyclesPerFrame: uint16(m.cyclesPerFrame),
+		},
+		FrameRate: uint16(m.frameRate),
+	})
+	binary.Write(out, binary.BigEndian, uint32(len(m.keys)))
+	binary.Write(out, binary.BigEndian, m.keys)
+	binary.Write(out, binary.BigEndian, uint32(len(m.checksums)))
+	binary.Write(out, binary.BigEndian, m.checksums)
+	return out.Flush()
+}
+
+func readMovie(r io.Reader) (*movie, error) {
+	in := bufio.NewReader(r)
+	var header movieHeader
+	if binary.Read(in, binary.BigEndian, &header) != nil || string(header.Magic[:]) != movieMagic {
+		return nil, errMovieMagic
+	}
+	var settings movieSettingsV2
+	switch header.Version {
+	case 1:
+		if err := binary.Read(in, binary.BigEndian, &settings.movieSettingsV1); err != nil {
+			return nil, fmt.Errorf("movie: truncated file")
+		}
+	case movieVersion:
+		if err := binary.Read(in, binary.BigEndian, &settings); err != nil {
+			return nil, fmt.Errorf("movie: truncated file")
+		}
+	default:
+		return nil, fmt.Errorf("movie: unsupported version %d, this go-8 reads up to version %d",
+			header.Version, movieVersion)
+	}
+	m := &movie{
+		romHash:        settings.ROMHash,
+		seed:           settings.Seed,
+		quirks:         quirksFromBits(settings.Quirks),
+		cyclesPerFrame: int(settings.CyclesPerFrame),
+		frameRate:      int(settings.FrameRate),
+	}
+	var n uint32
+	if err := binary.Read(in, binary.BigEndian, &n); err != nil {
+		return nil, fmt.Errorf("movie: truncated file")
+	}
+	if n > maxMovieFrames {
+		return nil, fmt.Errorf("movie: too many frames")
+	}
+	m.keys = make([]uint16, n)
+	if err := binary.Read(in, binary.BigEndian, m.keys); err != nil {
+		return nil, fmt.Errorf("movie: truncated file")
+	}
+	if err := binary.Read(in, binary.BigEndian, &n); err != nil {
+		return nil, fmt.Errorf("movie: truncated file")
+	}
+	if n > maxMovieFrames {
+		return nil, fmt.Errorf("movie: too many checksums")
+	}
+	m.checksums = make([]movieChecksum, n)
+	if err := binary.Read(in, binary.BigEndian, m.checksums); err != nil {
+		return nil, fmt.Errorf("movie: truncated file")
+	}
+	return m, nil
+}
+
+func saveMovie(m *movie, filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := m.write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func loadMovie(filename string) (*movie, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readMovie(f)
+}
+
+// moviePlayer - feeds the keypad state of a movie to the emulator
+type moviePlayer struct {
+	movie *movie
+	// frames played so far
+	frame int
+	// index of the next checksum to verify
+	checksum int
+}
+
+// play - sets emu, which has just loaded rom, up as the movie was recorded
+// and takes over its keypad
+func (m *movie) play(emu *Go8, rom []byte) (*moviePlayer, error) {
+	if sha256.Sum256(rom) != m.romHash {
+		return nil, fmt.Errorf("movie: recorded with a different ROM")
+	}
+	player := &moviePlayer{movie: m}
+	emu.SetRandomState(m.seed)
+	emu.quirks = m.quirks
+	emu.cyclesPerFrame = m.cyclesPerFrame
+	emu.frameRate = m.frameRate
+	emu.keypad = player.keys
+	return player, nil
+}
+
+func (player *moviePlayer) keys() [16]uint8 {
+	var keys uint16
+	if player.frame < len(player.movie.keys) {
+		keys = player.movie.keys[player.frame]
+	}
+	player.frame++
+	return unpackKeys(keys)
+}
+
+// done - whether every frame of the movie has been played
+func (player *moviePlayer) done() bool {
+	return player.frame >= len(player.movie.keys)
+}
+
+// verify - compares the state of emu with the movie after a frame,
+// returning an error if they differ
+func (player *moviePlayer) verify(emu *Go8) error {
+	checksums := player.movie.checksums
+	for player.checksum < len(checksums) && int(checksums[player.checksum].Frame) < player.frame {
+		player.checksum++
+	}
+	if player.checksum == len(checksums) || int(checksums[player.checksum].Frame) != player.frame {
+		return nil
+	}
+	expected := checksums[player.checksum].CRC
+	player.checksum++
+	if stateChecksum(emu) != expected {
+		return fmt.Errorf("movie: desync at frame %d", player.frame)
+	}
+	return nil
+}
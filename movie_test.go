@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// testMovieProgram - counts in V1 the frames in which a random key is down
+var testMovieProgram = []uint8{
+	0xC0, 0x0F, // 200: V0 = rand & 0F
+	0xE0, 0x9E, // 202: skip if key V0 down
+	0x12, 0x08, // 204: jump 208
+	0x71, 0x01, // 206: V1 += 1
+	0x12, 0x00, // 208: loop
+}
+
+// recordTestMovie - records frames of testMovieProgram with random keys
+func recordTestMovie(frames int) (*movie, []byte) {
+	graphics := &testGraphics{}
+	go8 := newGo8(&testSound{}, graphics, Quirks{Jump: true}, nil)
+	copy(go8.memory[0x200:], testMovieProgram)
+	m := newMovie(go8, testMovieProgram)
+	input := rand.New(rand.NewSource(7))
+	for i := 0; i < frames; i++ {
+		for key := range graphics.keys {
+			graphics.keys[key] = input.Intn(3) == 0
+		}
+		go8.RunFrame()
+		m.record(go8)
+	}
+	return m, go8.encodeState()
+}
+
+func playTestMovie(m *movie) (*Go8, *moviePlayer, error) {
+	go8 := newGo8(&testSound{}, &testGraphics{}, Quirks{}, nil)
+	copy(go8.memory[0x200:], testMovieProgram)
+	player, err := m.play(go8, testMovieProgram)
+	return go8, player, err
+}
+
+func TestMoviePlayback(t *testing.T) {
+	recorded, state := recordTestMovie(300)
+	var buf bytes.Buffer
+	if err := recorded.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	m, err := readMovie(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go8, player, err := playTestMovie(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for !player.done() {
+		go8.RunFrame()
+		if err := player.verify(go8); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if player.checksum != 300/movieChecksumInterval {
+		t.Errorf("Wrong number of checksums verified. Got %d, expected %d.", player.checksum, 300/movieChecksumInterval)
+	}
+	if !bytes.Equal(go8.encodeState(), state) {
+		t.Error("Played back state differs from the recording.")
+	}
+	if go8.V[1] == 0 {
+		t.Error("Keypad input not played back.")
+	}
+}
+
+func TestMovieDesync(t *testing.T) {
+	m, _ := recordTestMovie(120)
+	// change an input in the first checksum interval
+	for i := 10; i < 50; i++ {
+		m.keys[i] = ^m.keys[i]
+	}
+	go8, player, err := playTestMovie(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for !player.done() {
+		go8.RunFrame()
+		if err = player.verify(go8); err != nil {
+			break
+		}
+	}
+	if err == nil || !strings.Contains(err.Error(), "desync at frame 60") {
+		t.Errorf("Wrong error. Got %v, expected a desync at frame 60.", err)
+	}
+}
+
+func TestMovieSettings(t *testing.T) {
+	go8 := newGo8(&testSound{}, &testGraphics{}, Quirks{}, newSplitMix(0x1234))
+	go8.frameRate = 30
+	recorded := newMovie(go8, testMovieProgram)
+	var buf bytes.Buffer
+	recorded.write(&buf)
+	m, err := readMovie(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go8, _, err = playTestMovie(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if go8.RandomState() != 0x1234 {
+		t.Errorf("Wrong random state. Got %x, expected 1234.", go8.RandomState())
+	}
+	if go8.frameRate != 30 {
+		t.Errorf("Wrong frame rate. Got %d, expected 30.", go8.frameRate)
+	}
+
+	// version 1 movies play back at 60 frames per second
+	var v1 bytes.Buffer
+	binary.Write(&v1, binary.BigEndian, movieHeader{Magic: [4]byte{'G', 'O', '8', 'M'}, Version: 1})
+	binary.Write(&v1, binary.BigEndian, movieSettingsV1{ROMHash: recorded.romHash, Seed: 0x42})
+	binary.Write(&v1, binary.BigEndian, [2]uint32{})
+	m, err = readMovie(&v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go8 = newGo8(&testSound{}, &testGraphics{}, Quirks{}, nil)
+	go8.frameRate = 30
+	if _, err := m.play(go8, testMovieProgram); err != nil {
+		t.Fatal(err)
+	}
+	if go8.RandomState() != 0x42 || go8.framesPerSecond() != timerRate {
+		t.Errorf("Wrong settings from version 1. Got random state %x at %d fps, expected 42 at %d.",
+			go8.RandomState(), go8.framesPerSecond(), timerRate)
+	}
+}
+
+func TestMovieROMHash(t *testing.T) {
+	m, _ := recordTestMovie(1)
+	go8 := newGo8(&testSound{}, &testGraphics{}, Quirks{}, nil)
+	if _, err := m.play(go8, []byte{0x12, 0x00}); err == nil {
+		t.Error("No error playing a movie with another ROM.")
+	}
+	if go8.keypad != nil {
+		t.Error("Keypad taken over by a movie that failed to play.")
+	}
+}
+
+func TestReadMovieErrors(t *testing.T) {
+	m, _ := recordTestMovie(10)
+	var buf bytes.Buffer
+	m.write(&buf)
+	valid := buf.Bytes()
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"empty", nil, "not a go-8 movie"},
+		{"magic", append([]byte("XXXX"), valid[4:]...), "not a go-8 movie"},
+		{"version", append([]byte("GO8M\x00\x09"), valid[6:]...), "unsupported version 9"},
+		{"truncated", valid[:len(valid)-3], "truncated"},
+	}
+	for _, test := range tests {
+		if _, err := readMovie(bytes.NewReader(test.data)); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: Wrong error. Got %v, expected %s.", test.name, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+// options - command line options for running the emulator
+type options struct {
+	rom string
+	// frames per second and instructions per frame
+	frameRate      int
+	cyclesPerFrame int
+	quirks         Quirks
+	// random source for CXNN
+	random Random
+	// buzzer sound and volume
+	tone  tone
+	debug bool
+	// rewind memory budget in bytes, 0 disables rewinding
+	rewindBudget int
+	// movie files to record to or play back
+	record string
+	play   string
+	// where to draw: window or terminal, and how long the terminal holds
+	// a key after each press
+	backend    string
+	keyRelease time.Duration
+	// serve the Debug Adapter Protocol on stdio or a TCP address
+	dapStdio bool
+	dapAddr  string
+	// run without a window or audio for frames frames, 0 until the ROM
+	// exits or headlessFrameLimit, with the keypad scripted by keys
+	headless bool
+	frames   int
+	keys     string
+	// PNG to save at exit and GIF to record with -headless, scale is
+	// image pixels per hires pixel
+	screenshot string
+	gif        string
+	scale      int
+	// colours of the display and images
+	palette palette
+	// display filter against flicker, nil for none
+	filter displayFilter
+	// start the window fullscreen, scale it by whole pixels only
+	fullscreen   bool
+	integerScale bool
+	// pixel art scaling in the window, nil for none
+	upscaler *upscaler
+	// keymap preset, empty for the keymap file's, and the file with the
+	// keymaps for all and for single ROMs
+	keymap     string
+	keymapFile string
+}
+
+// getFlags - parses the emulator flags in args
+func getFlags(args []string) options {
+	rom := flag.String("rom", "roms/tetris.ch8", "Path to rom.")
+	timerFreq := flag.Int("timerFreq", timerRate, "Frame rate in Hz, the timers count down at 60 Hz at any rate.")
+	clockFreq := flag.Int("clockFreq", 300, "Clock speed in Hz.")
+	quirksName := flag.String("quirks", "xochip", "Quirks profile: vip, chip48, schip or xochip.")
+	seed := flag.Uint64("seed", 0, "Random seed, 0 seeds from the clock.")
+	backend := flag.String("backend", "window", "Display backend: window or terminal.")
+	keyRelease := flag.Int("keyRelease", int(terminalKeyRelease/time.Millisecond), "Milliseconds a key counts as held after each press with -backend terminal.")
+	toneFreq := flag.Float64("toneFreq", defaultTone.frequency, "Buzzer frequency in Hz.")
+	volume := flag.Float64("volume", defaultTone.volume, "Volume from 0 to 1.")
+	waveformName := flag.String("waveform", "square", "Buzzer waveform: square, triangle, sawtooth or sine.")
+	debug := flag.Bool("debug", false, "Start paused in the command line debugger.")
+	rewindBudget := flag.Int("rewind", defaultRewindBudget>>20, "Rewind memory budget in MiB, 0 disables rewinding.")
+	record := flag.String("record", "", "Record the keypad input to a movie file.")
+	play := flag.String("play", "", "Play back the keypad input from a movie file.")
+	dapAddr := flag.String("dap", "", "Serve the Debug Adapter Protocol on this address, e.g. localhost:4711.")
+	headless := flag.Bool("headless", false, "Run without a window or audio, printing the registers and screen at exit.")
+	frames := flag.Int("frames", 0, "Frames to run with -headless, 0 runs until the ROM exits and fails after ten minutes of play.")
+	keys := flag.String("keys", "", "Keypad script for -headless, e.g. \"60:5 62: 120:46\", or @file to read it from a file.")
+	screenshot := flag.String("screenshot", "", "PNG file to save the screen to at exit with -headless.")
+	gifFile := flag.String("gif", "", "GIF file to record every frame to with -headless.")
+	scale := flag.Int("scale", defaultCaptureScale, "Image pixels per hires pixel in screenshots and GIFs.")
+	paletteName := flag.String("palette", "default", "Display colours: default, octo, lcd, amber or background,plane1[,plane2,both] like #000000,#FFFFFF.")
+	filterName := flag.String("filter", "none", "Display filter against flicker: none, phosphor or or.")
+	persistence := flag.Int("persistence", defaultPersistence, "Frames pixels take to fade out with -filter phosphor.")
+	fullscreen := flag.Bool("fullscreen", false, "Start fullscreen, F11 switches back to a window.")
+	integerScale := flag.Bool("integerScale", false, "Scale the display by whole pixels only, letterboxing the rest of the window.")
+	upscale := flag.String("upscale", "nearest", "Pixel art scaling in the window: nearest, scale2x, scale3x or epx.")
+	keymapName := flag.String("keymap", "", "Keymap preset: vip, dream6800 or arrows, replacing the keys for all ROMs from the keymap file.")
+	keymapFile := flag.String("keymapFile", "", "Keymap file with the keys for all ROMs and for single ROMs, defaults to "+defaultKeymapPath()+".")
+	config := flag.String("config", "", "Config file of name = value settings, defaults to "+defaultConfigPath()+" if it exists.")
+	flag.CommandLine.Parse(args)
+	if *config != "" {
+		check(applyConfig(flag.CommandLine, *config, true))
+	} else if path := defaultConfigPath(); path != "" {
+		check(applyConfig(flag.CommandLine, path, false))
+	}
+	if flag.NArg() > 0 {
+		*rom = flag.Arg(0)
+	}
+	quirks, err := getQuirks(*quirksName)
+	check(err)
+	if *seed == 0 {
+		*seed = uint64(time.Now().UnixNano())
+	}
+	wave, err := getWaveform(*waveformName)
+	check(err)
+	if *toneFreq <= 0 || *volume < 0 || *volume > 1 {
+		check(fmt.Errorf("invalid tone: %g Hz at volume %g", *toneFreq, *volume))
+	}
+	pal, err := getPalette(*paletteName)
+	check(err)
+	filter, err := getFilter(*filterName, *persistence)
+	check(err)
+	upscaler, err := getUpscaler(*upscale)
+	check(err)
+	if *keymapName != "" {
+		_, err := getKeymap(*keymapName)
+		check(err)
+	}
+	if *keymapFile == "" {
+		*keymapFile = defaultKeymapPath()
+	}
+	if *backend != "window" && *backend != "terminal" {
+		check(fmt.Errorf("unknown backend %q, expected window or terminal", *backend))
+	}
+	if *keyRelease <= 0 {
+		check(fmt.Errorf("invalid key release time %d ms", *keyRelease))
+	}
+	if *scale < 1 {
+		check(fmt.Errorf("invalid scale %d", *scale))
+	}
+	if *timerFreq <= 0 || *clockFreq < *timerFreq {
+		check(fmt.Errorf("invalid speed: %d Hz at %d frames per second, both must be positive and the clock at least the frame rate",
+			*clockFreq, *timerFreq))
+	}
+	return options{
+		rom:            *rom,
+		frameRate:      *timerFreq,
+		cyclesPerFrame: *clockFreq / *timerFreq,
+		quirks:         quirks,
+		random:         newSplitMix(*seed),
+		tone:           tone{frequency: *toneFreq, volume: *volume, waveform: wave},
+		debug:          *debug,
+		rewindBudget:   *rewindBudget << 20,
+		record:         *record,
+		play:           *play,
+		backend:        *backend,
+		keyRelease:     time.Duration(*keyRelease) * time.Millisecond,
+		dapAddr:        *dapAddr,
+		headless:       *headless,
+		frames:         *frames,
+		keys:           *keys,
+		screenshot:     *screenshot,
+		gif:            *gifFile,
+		scale:          *scale,
+		palette:        pal,
+		filter:         filter,
+		fullscreen:     *fullscreen,
+		integerScale:   *integerScale,
+		upscaler:       upscaler,
+		keymap:         *keymapName,
+		keymapFile:     *keymapFile,
+	}
+}
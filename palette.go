@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// palette - display colours, indexed by the planes a pixel is set in: the
+// background, plane 1, plane 2 and both planes
+type palette [4]color.RGBA
+
+// Display values hold the planes of a pixel in the low two bits and, for
+// pixels fading out, how far they have faded towards the background in
+// 1/64ths in the upper six.
+const maxFade = 63
+
+// palettes - the presets, the default is white on black with greys for
+// XO-CHIP's second plane
+var palettes = map[string]palette{
+	"default": mustPalette("#000000,#FFFFFF,#AAAAAA,#555555"),
+	// the colours of Octo, the XO-CHIP IDE
+	"octo":  mustPalette("#996600,#FFCC00,#FF6600,#662200"),
+	"lcd":   mustPalette("#9BBC0F,#0F380F,#306230,#8BAC0F"),
+	"amber": mustPalette("#140C00,#FFB000,#9C5A00,#FFE08A"),
+}
+
+var defaultPalette = palettes["default"]
+
+// getPalette - the preset named spec, or the colours it lists
+func getPalette(spec string) (palette, error) {
+	if pal, ok := palettes[spec]; ok {
+		return pal, nil
+	}
+	if !strings.Contains(spec, ",") {
+		var names []string
+		for name := range palettes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return palette{}, fmt.Errorf("unknown palette %q, expected one of %s or colours like #000000,#FFFFFF",
+			spec, strings.Join(names, ", "))
+	}
+	return parsePalette(spec)
+}
+
+// parsePalette - parses background,plane1[,plane2,both] in #RRGGBB hex.
+// Without colours for plane 2 and both planes they are drawn like plane 1.
+func parsePalette(spec string) (palette, error) {
+	colors := strings.Split(spec, ",")
+	if len(colors) != 2 && len(colors) != 4 {
+		return palette{}, fmt.Errorf("palette %q has %d colours, expected 2 or 4", spec, len(colors))
+	}
+	var pal palette
+	for i := range pal {
+		text := colors[0]
+		if i > 0 {
+			text = colors[(i-1)%(len(colors)-1)+1]
+		}
+		c, err := parseColor(strings.TrimSpace(text))
+		if err != nil {
+			return palette{}, err
+		}
+		pal[i] = c
+	}
+	return pal, nil
+}
+
+func mustPalette(spec string) palette {
+	pal, err := parsePalette(spec)
+	check(err)
+	return pal
+}
+
+// parseColor - parses #RRGGBB
+func parseColor(text string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(text, "#")
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 6 || err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q, expected #RRGGBB", text)
+	}
+	return color.RGBA{uint8(value >> 16), uint8(value >> 8), uint8(value), 0xFF}, nil
+}
+
+// color - the colour of a display value
+func (pal palette) color(p uint8) color.RGBA {
+	c := pal[p&3]
+	fade := int(p >> 2)
+	if fade == 0 {
+		return c
+	}
+	bg := pal[0]
+	mix := func(a, b uint8) uint8 {
+		return uint8((int(a)*(maxFade+1-fade) + int(b)*fade) / (maxFade + 1))
+	}
+	return color.RGBA{mix(c.R, bg.R), mix(c.G, bg.G), mix(c.B, bg.B), 0xFF}
+}
+
+// colors - the colours of all display values, for paletted images
+func (pal palette) colors() color.Palette {
+	colors := make(color.Palette, 256)
+	for i := range colors {
+		colors[i] = pal.color(uint8(i))
+	}
+	return colors
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestGetPalette(t *testing.T) {
+	white := color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	tests := []struct {
+		spec     string
+		expected palette
+		err      string
+	}{
+		{"octo", palettes["octo"], ""},
+		{"#000000,#FFFFFF", palette{{0, 0, 0, 0xFF}, white, white, white}, ""},
+		{"#102030, #ffffff, #FF0000, #00ff00", palette{{0x10, 0x20, 0x30, 0xFF}, white, {0xFF, 0, 0, 0xFF}, {0, 0xFF, 0, 0xFF}}, ""},
+		{"gameboy", palette{}, "unknown palette"},
+		{"#000000,#FFFFFF,#FF0000", palette{}, "has 3 colours"},
+		{"#000000,#FFF", palette{}, "invalid colour"},
+		{"#000000,#GGGGGG", palette{}, "invalid colour"},
+	}
+	for _, test := range tests {
+		pal, err := getPalette(test.spec)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: Wrong error. Got %v, expected %s.", test.spec, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.spec, err)
+		} else if pal != test.expected {
+			t.Errorf("%s: Wrong palette. Got %v, expected %v.", test.spec, pal, test.expected)
+		}
+	}
+	if palettes["octo"][1] != (color.RGBA{0xFF, 0xCC, 0x00, 0xFF}) {
+		t.Errorf("Wrong Octo plane 1 colour. Got %v.", palettes["octo"][1])
+	}
+}
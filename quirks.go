@@ -0,0 +1,48 @@
+package main
+
+import "fmt"
+
+// Quirks - toggles for instructions whose behavior differs between
+// CHIP-8 interpreters. The zero value is the XO-CHIP behavior.
+type Quirks struct {
+	// 8XY6/8XYE shift VX in place instead of shifting VY into VX
+	Shift bool
+	// FX55/FX65 leave index unchanged instead of incrementing it
+	LoadStore bool
+	// BNNN jumps to XNN + VX instead of NNN + V0
+	Jump bool
+	// 8XY1/8XY2/8XY3 reset VF to 0
+	VFReset bool
+	// sprites are clipped at the screen edges instead of wrapping
+	Clip bool
+	// DXYN waits for the next vertical blank before execution continues
+	DisplayWait bool
+}
+
+var quirkPresets = map[string]Quirks{
+	"vip": {
+		VFReset:     true,
+		Clip:        true,
+		DisplayWait: true,
+	},
+	"chip48": {
+		Shift: true,
+		Jump:  true,
+		Clip:  true,
+	},
+	"schip": {
+		Shift:     true,
+		LoadStore: true,
+		Jump:      true,
+		Clip:      true,
+	},
+	"xochip": {},
+}
+
+func getQuirks(name string) (Quirks, error) {
+	quirks, ok := quirkPresets[name]
+	if !ok {
+		return Quirks{}, fmt.Errorf("unknown quirks profile: %s", name)
+	}
+	return quirks, nil
+}
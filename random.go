@@ -0,0 +1,39 @@
+package main
+
+// Random - the random source for CXNN. Its whole state is one word, so a
+// run can be saved and resumed exactly.
+type Random interface {
+	// Byte - the next random byte
+	Byte() uint8
+	State() uint64
+	SetState(state uint64)
+}
+
+// splitMix - SplitMix64 generator, the default random source
+type splitMix struct {
+	state uint64
+}
+
+func newSplitMix(seed uint64) Random {
+	return &splitMix{state: seed}
+}
+
+func (rng *splitMix) next() uint64 {
+	rng.state += 0x9E3779B97F4A7C15
+	z := rng.state
+	z = (z ^ z>>30) * 0xBF58476D1CE4E5B9
+	z = (z ^ z>>27) * 0x94D049BB133111EB
+	return z ^ z>>31
+}
+
+func (rng *splitMix) Byte() uint8 {
+	return uint8(rng.next())
+}
+
+func (rng *splitMix) State() uint64 {
+	return rng.state
+}
+
+func (rng *splitMix) SetState(state uint64) {
+	rng.state = state
+}
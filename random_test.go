@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestRandomRepeats(t *testing.T) {
+	a, b := newSplitMix(1234), newSplitMix(1234)
+	var state uint64
+	var afterState []uint8
+	for i := 0; i < 100; i++ {
+		if i == 50 {
+			state = a.State()
+		}
+		x := a.Byte()
+		if i >= 50 {
+			afterState = append(afterState, x)
+		}
+		if y := b.Byte(); x != y {
+			t.Fatalf("Same seed, different values at %d. Got %x, expected %x.", i, y, x)
+		}
+	}
+	b.SetState(state)
+	for i, expected := range afterState {
+		if x := b.Byte(); x != expected {
+			t.Fatalf("Wrong value after restoring the state at %d. Got %x, expected %x.", i, x, expected)
+		}
+	}
+}
+
+func TestRandomState(t *testing.T) {
+	go8 := newGo8(&testSound{}, nil, Quirks{}, newSplitMix(5))
+	go8.opcode = 0xC0FF
+	go8.SetRandomState(99)
+	go8.rand()
+	first := go8.V[0]
+	go8.SetRandomState(99)
+	go8.rand()
+	if go8.V[0] != first {
+		t.Errorf("Wrong value after restoring the random state. Got %x, expected %x.", go8.V[0], first)
+	}
+}
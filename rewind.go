@@ -0,0 +1,140 @@
+package main
+
+import "encoding/binary"
+
+// default rewind memory budget, a few minutes of typical gameplay
+const defaultRewindBudget = 16 << 20
+
+// rewinder - keeps the machine state of past frames so they can be
+// played back in reverse. Only the latest state is kept in full; each
+// earlier frame is the difference from the frame after it, so stepping
+// back undoes one difference at a time. The oldest frames are dropped
+// when the budget in bytes is exceeded.
+type rewinder struct {
+	budget int
+	// encoded state of the latest recorded frame
+	current []byte
+	// deltas[i] turns the state after it back into the state before it
+	deltas ring
+	size   int
+}
+
+func newRewinder(budget int) *rewinder {
+	return &rewinder{budget: budget}
+}
+
+// record - adds the state of the frame that just ran
+func (rw *rewinder) record(emu *Go8) {
+	state := emu.encodeState()
+	if rw.current != nil {
+		delta := diffState(rw.current, state)
+		rw.deltas.push(delta)
+		rw.size += len(delta)
+	}
+	rw.current = state
+	for rw.deltas.len() > 0 && len(rw.current)+rw.size > rw.budget {
+		rw.size -= len(rw.deltas.popOldest())
+	}
+}
+
+// rewind - restores the frame before the latest one, returns false if
+// there is none left
+func (rw *rewinder) rewind(emu *Go8) bool {
+	if rw.deltas.len() == 0 {
+		return false
+	}
+	delta := rw.deltas.popNewest()
+	rw.size -= len(delta)
+	applyDelta(rw.current, delta)
+	return emu.decodeState(rw.current) == nil
+}
+
+// frames - the number of frames that can be rewound
+func (rw *rewinder) frames() int {
+	return rw.deltas.len()
+}
+
+// diffState - run-length encodes a XOR b, which must have the same length,
+// as pairs of unchanged and changed byte counts followed by the changed
+// bytes XORed
+func diffState(a, b []byte) []byte {
+	var delta []byte
+	var buf [binary.MaxVarintLen64]byte
+	for i := 0; i < len(a); {
+		same := i
+		for same < len(a) && a[same] == b[same] {
+			same++
+		}
+		changed := same
+		for changed < len(a) && a[changed] != b[changed] {
+			changed++
+		}
+		if same == len(a) {
+			break
+		}
+		delta = append(delta, buf[:binary.PutUvarint(buf[:], uint64(same-i))]...)
+		delta = append(delta, buf[:binary.PutUvarint(buf[:], uint64(changed-same))]...)
+		for j := same; j < changed; j++ {
+			delta = append(delta, a[j]^b[j])
+		}
+		i = changed
+	}
+	return delta
+}
+
+// applyDelta - XORs a delta from diffState into state, turning one of the
+// states it was made from into the other
+func applyDelta(state, delta []byte) {
+	pos := 0
+	for len(delta) > 0 {
+		same, n := binary.Uvarint(delta)
+		delta = delta[n:]
+		changed, n := binary.Uvarint(delta)
+		delta = delta[n:]
+		pos += int(same)
+		for i := 0; i < int(changed); i++ {
+			state[pos+i] ^= delta[i]
+		}
+		pos += int(changed)
+		delta = delta[changed:]
+	}
+}
+
+// ring - a queue of byte slices that grows as needed
+type ring struct {
+	items [][]byte
+	start int
+	n     int
+}
+
+func (r *ring) len() int {
+	return r.n
+}
+
+func (r *ring) push(item []byte) {
+	if r.n == len(r.items) {
+		items := make([][]byte, 2*len(r.items)+1)
+		for i := 0; i < r.n; i++ {
+			items[i] = r.items[(r.start+i)%len(r.items)]
+		}
+		r.items, r.start = items, 0
+	}
+	r.items[(r.start+r.n)%len(r.items)] = item
+	r.n++
+}
+
+func (r *ring) popOldest() []byte {
+	item := r.items[r.start]
+	r.items[r.start] = nil
+	r.start = (r.start + 1) % len(r.items)
+	r.n--
+	return item
+}
+
+func (r *ring) popNewest() []byte {
+	i := (r.start + r.n - 1) % len(r.items)
+	item := r.items[i]
+	r.items[i] = nil
+	r.n--
+	return item
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestDiffState(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		a := make([]byte, 1+r.Intn(200))
+		r.Read(a)
+		b := append([]byte{}, a...)
+		for j := r.Intn(20); j > 0; j-- {
+			b[r.Intn(len(b))] = byte(r.Intn(256))
+		}
+		delta := diffState(a, b)
+		state := append([]byte{}, b...)
+		applyDelta(state, delta)
+		if !bytes.Equal(state, a) {
+			t.Fatalf("Delta does not restore the earlier state.\n% x\n% x", state, a)
+		}
+		applyDelta(state, delta)
+		if !bytes.Equal(state, b) {
+			t.Fatalf("Delta does not restore the later state.\n% x\n% x", state, b)
+		}
+	}
+	if delta := diffState([]byte{1, 2, 3}, []byte{1, 2, 3}); len(delta) != 0 {
+		t.Errorf("Wrong delta for equal states. Got % x, expected none.", delta)
+	}
+}
+
+func TestRewind(t *testing.T) {
+	go8 := newTestStateGo8(&testGraphics{})
+	rw := newRewinder(defaultRewindBudget)
+	var states [][]byte
+	for i := 0; i < 30; i++ {
+		go8.RunFrame()
+		rw.record(go8)
+		states = append(states, go8.encodeState())
+	}
+	if rw.frames() != 29 {
+		t.Errorf("Wrong number of frames. Got %d, expected %d.", rw.frames(), 29)
+	}
+	// a frame changes a few bytes, not the whole state
+	if rw.size > 30*256 {
+		t.Errorf("Deltas not compact. Got %d bytes for 29 frames.", rw.size)
+	}
+	for i := len(states) - 2; i >= 0; i-- {
+		if !rw.rewind(go8) {
+			t.Fatalf("Rewind stopped early at frame %d.", i)
+		}
+		if !bytes.Equal(go8.encodeState(), states[i]) {
+			t.Fatalf("Wrong state rewinding to frame %d.", i)
+		}
+	}
+	if rw.rewind(go8) {
+		t.Error("Rewound past the first frame.")
+	}
+	// recording continues from the rewound frame
+	go8.RunFrame()
+	rw.record(go8)
+	if !rw.rewind(go8) || !bytes.Equal(go8.encodeState(), states[0]) {
+		t.Error("Wrong state after recording a rewound frame.")
+	}
+}
+
+func TestRewindBudget(t *testing.T) {
+	go8 := newTestStateGo8(&testGraphics{})
+	stateSize := len(go8.encodeState())
+	budget := stateSize + 1000
+	rw := newRewinder(budget)
+	for i := 0; i < 200; i++ {
+		go8.RunFrame()
+		rw.record(go8)
+		if len(rw.current)+rw.size > budget {
+			t.Fatalf("Budget exceeded. Got %d bytes, expected at most %d.", len(rw.current)+rw.size, budget)
+		}
+	}
+	if rw.frames() == 0 || rw.frames() >= 199 {
+		t.Errorf("Wrong number of frames kept. Got %d.", rw.frames())
+	}
+	for rw.rewind(go8) {
+	}
+	if go8.pc < 0x200 || go8.pc > 0x214 {
+		t.Errorf("Invalid state after rewinding everything. Got pc %x.", go8.pc)
+	}
+}
+
+func TestRing(t *testing.T) {
+	var r ring
+	next := 0
+	oldest := 0
+	for i := 0; i < 50; i++ {
+		r.push([]byte{byte(next)})
+		next++
+		if i%3 == 0 {
+			if item := r.popOldest(); item[0] != byte(oldest) {
+				t.Fatalf("Wrong oldest item. Got %d, expected %d.", item[0], oldest)
+			}
+			oldest++
+		}
+	}
+	for r.len() > 0 {
+		next--
+		if item := r.popNewest(); item[0] != byte(next) {
+			t.Fatalf("Wrong newest item. Got %d, expected %d.", item[0], next)
+		}
+	}
+	if next != oldest {
+		t.Errorf("Wrong number of items. Got %d, expected %d.", next-oldest, 0)
+	}
+}
+
+func TestRewindSound(t *testing.T) {
+	sound := &testSound{}
+	go8 := newGo8(sound, &testGraphics{}, Quirks{}, nil)
+	copy(go8.memory[0x200:], []uint8{0x12, 0x00})
+	rw := newRewinder(defaultRewindBudget)
+	rw.record(go8)
+	go8.soundTimer = 10
+	go8.updateSound()
+	for i := 0; i < 5; i++ {
+		go8.RunFrame()
+		rw.record(go8)
+	}
+	// rewinding while the sound plays keeps it playing
+	for i := 0; i < 4; i++ {
+		rw.rewind(go8)
+	}
+	if sound.starts != 1 || !sound.playing {
+		t.Errorf("Sound restarted while rewinding. Got %d starts, playing %t, expected 1, true.", sound.starts, sound.playing)
+	}
+	rw.rewind(go8)
+	if sound.playing {
+		t.Error("Sound not stopped rewinding to before it started.")
+	}
+	// a new pattern restarts the sound with it
+	go8.soundTimer = 10
+	go8.updateSound()
+	state := go8.state()
+	state.Audio[0] = 0xFF
+	state.AudioLoaded = true
+	go8.setState(state)
+	if sound.starts != 3 {
+		t.Errorf("Sound not restarted with a new pattern. Got %d starts, expected 3.", sound.starts)
+	}
+}
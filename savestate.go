@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Save state files are a magic header, a format version, the machine
+// state and a CRC-32 of everything before it, all big-endian. A new
+// version adds a state struct and a migration from the one before.
+const (
+	stateMagic   = "GO8S"
+	stateVersion = 2
+	// save slots selectable with hotkeys
+	stateSlots = 9
+)
+
+var (
+	errStateMagic    = errors.New("savestate: not a go-8 save state")
+	errStateChecksum = errors.New("savestate: checksum mismatch, the file is corrupt")
+	errStateInvalid  = errors.New("savestate: invalid machine state")
+)
+
+type stateHeader struct {
+	Magic   [4]byte
+	Version uint16
+}
+
+// stateV1 - the machine state in format version 1
+type stateV1 struct {
+	Memory      [memorySize]uint8
+	V           [16]uint8
+	Index       uint16
+	PC          uint16
+	Opcode      uint16
+	Stack       [16]uint16
+	SP          uint16
+	DelayTimer  uint8
+	SoundTimer  uint8
+	Gfx         [hiresWidth * hiresHeight]uint8
+	Hires       bool
+	Plane       uint8
+	Key         [16]uint8
+	DrawFlag    bool
+	VblankWait  bool
+	Exited      bool
+	Audio       [patternSize]uint8
+	Pitch       uint8
+	AudioLoaded bool
+	RPL         [16]uint8
+	Quirks      uint8
+	RNG         uint64
+}
+
+// stateV2 - version 2 adds how far the timers are towards their next tick
+type stateV2 struct {
+	stateV1
+	TimerPhase uint32
+}
+
+// migrateV1 - a version 1 state as version 2, the timers at the start of
+// a tick
+func migrateV1(state *stateV1) *stateV2 {
+	return &stateV2{stateV1: *state}
+}
+
+// quirkBits - quirks as a bit field, in the order Quirks declares them
+func quirkBits(q Quirks) uint8 {
+	var bits uint8
+	for i, set := range []bool{q.Shift, q.LoadStore, q.Jump, q.VFReset, q.Clip, q.DisplayWait} {
+		if set {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits
+}
+
+func quirksFromBits(bits uint8) Quirks {
+	bit := func(i uint) bool { return bits&(1<<i) != 0 }
+	return Quirks{
+		Shift:       bit(0),
+		LoadStore:   bit(1),
+		Jump:        bit(2),
+		VFReset:     bit(3),
+		Clip:        bit(4),
+		DisplayWait: bit(5),
+	}
+}
+
+// state - the machine state in the current format
+func (emu *Go8) state() *stateV2 {
+	return &stateV2{
+		stateV1: stateV1{
+			Memory:      emu.memory,
+			V:           emu.V,
+			Index:       emu.index,
+			PC:          emu.pc,
+			Opcode:      emu.opcode,
+			Stack:       emu.stack,
+			SP:          emu.sp,
+			DelayTimer:  emu.delayTimer,
+			SoundTimer:  emu.soundTimer,
+			Gfx:         emu.gfx,
+			Hires:       emu.hires,
+			Plane:       emu.plane,
+			Key:         emu.key,
+			DrawFlag:    emu.drawFlag,
+			VblankWait:  emu.vblankWait,
+			Exited:      emu.exited,
+			Audio:       emu.audio.buffer,
+			Pitch:       emu.audio.pitch,
+			AudioLoaded: emu.audioLoaded,
+			RPL:         emu.rpl,
+			Quirks:      quirkBits(emu.quirks),
+			RNG:         emu.RandomState(),
+		},
+		TimerPhase: uint32(emu.timerPhase),
+	}
+}
+
+// setState - restores state, which must be valid. The sound is only
+// restarted if it starts, stops or changes voice, so rewinding through a
+// beep does not restart it every frame.
+func (emu *Go8) setState(state *stateV2) {
+	wasPlaying, audio, audioLoaded := emu.soundTimer > 0, emu.audio, emu.audioLoaded
+	emu.memory = state.Memory
+	emu.V = state.V
+	emu.index = state.Index
+	emu.pc = state.PC
+	emu.opcode = state.Opcode
+	emu.stack = state.Stack
+	emu.sp = state.SP
+	emu.delayTimer = state.DelayTimer
+	emu.soundTimer = state.SoundTimer
+	emu.timerPhase = int(state.TimerPhase)
+	emu.gfx = state.Gfx
+	emu.hires = state.Hires
+	emu.plane = state.Plane
+	emu.key = state.Key
+	emu.drawFlag = state.DrawFlag
+	emu.vblankWait = state.VblankWait
+	emu.exited = state.Exited
+	emu.audio.buffer = state.Audio
+	emu.audio.pitch = state.Pitch
+	emu.audioLoaded = state.AudioLoaded
+	emu.rpl = state.RPL
+	emu.quirks = quirksFromBits(state.Quirks)
+	emu.SetRandomState(state.RNG)
+	playing := emu.soundTimer > 0
+	voiceChanged := emu.audio != audio || emu.audioLoaded != audioLoaded
+	if emu.sound != nil && (playing != wasPlaying || playing && voiceChanged) {
+		emu.updateSound()
+	}
+}
+
+func (state *stateV1) valid() bool {
+	return int(state.SP) <= len(state.Stack) && state.Plane <= 3
+}
+
+// encodeState - the machine state without header and checksum
+func (emu *Go8) encodeState() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, emu.state())
+	return buf.Bytes()
+}
+
+// decodeState - restores a state encoded by encodeState
+func (emu *Go8) decodeState(data []byte) error {
+	var state stateV2
+	if err := binary.Read(bytes.NewReader(data), binary.BigEndian, &state); err != nil {
+		return err
+	}
+	return emu.restoreState(&state)
+}
+
+// restoreState - restores state if it is valid
+func (emu *Go8) restoreState(state *stateV2) error {
+	if !state.valid() {
+		return errStateInvalid
+	}
+	emu.setState(state)
+	return nil
+}
+
+// SaveState - writes the machine state to w
+func (emu *Go8) SaveState(w io.Writer) error {
+	var buf bytes.Buffer
+	header := stateHeader{Version: stateVersion}
+	copy(header.Magic[:], stateMagic)
+	binary.Write(&buf, binary.BigEndian, header)
+	buf.Write(emu.encodeState())
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(buf.Bytes()))
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// LoadState - restores a state written by SaveState. The machine is left
+// unchanged if the state cannot be read.
+func (emu *Go8) LoadState(r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var header stateHeader
+	if binary.Read(bytes.NewReader(data), binary.BigEndian, &header) != nil || string(header.Magic[:]) != stateMagic {
+		return errStateMagic
+	}
+	// older versions are migrated as the format changes
+	var state interface{}
+	switch header.Version {
+	case 1:
+		state = &stateV1{}
+	case stateVersion:
+		state = &stateV2{}
+	default:
+		return fmt.Errorf("savestate: unsupported version %d, this go-8 reads up to version %d",
+			header.Version, stateVersion)
+	}
+	size := binary.Size(header) + binary.Size(state)
+	if len(data) != size+4 {
+		return errStateChecksum
+	}
+	if crc32.ChecksumIEEE(data[:size]) != binary.BigEndian.Uint32(data[size:]) {
+		return errStateChecksum
+	}
+	if err := binary.Read(bytes.NewReader(data[binary.Size(header):size]), binary.BigEndian, state); err != nil {
+		return err
+	}
+	if v1, ok := state.(*stateV1); ok {
+		state = migrateV1(v1)
+	}
+	return emu.restoreState(state.(*stateV2))
+}
+
+// slotPath - the file for save slot n of rom, next to the ROM
+func slotPath(rom string, slot int) string {
+	return fmt.Sprintf("%s.state%d", strings.TrimSuffix(rom, filepath.Ext(rom)), slot)
+}
+
+// saveSlot - saves the state to filename, replacing it only once the new
+// state is completely written
+func (emu *Go8) saveSlot(filename string) error {
+	tmp := filename + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = emu.SaveState(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+func (emu *Go8) loadSlot(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return emu.LoadState(f)
+}
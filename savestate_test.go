@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testStateProgram - draws random sprites at random positions, so the
+// display depends on the random source, the timers and the keypad
+var testStateProgram = []uint8{
+	0xC0, 0x3F, // 200: V0 = rand & 3F
+	0xC1, 0x1F, // 202: V1 = rand & 1F
+	0xC2, 0x0F, // 204: V2 = rand & 0F
+	0xF2, 0x29, // 206: index = font V2
+	0xD0, 0x15, // 208: draw
+	0xF3, 0x07, // 20A: V3 = delay timer
+	0x33, 0x00, // 20C: skip if V3 == 0
+	0x12, 0x00, // 20E: loop
+	0x63, 0x05, // 210: V3 = 5
+	0xF3, 0x15, // 212: delay timer = V3
+	0x12, 0x00, // 214: loop
+}
+
+func newTestStateGo8(graphics *testGraphics) *Go8 {
+	go8 := newGo8(&testSound{}, graphics, Quirks{Clip: true, VFReset: true}, newSplitMix(42))
+	copy(go8.memory[0x200:], testStateProgram)
+	return go8
+}
+
+func TestSaveStateResume(t *testing.T) {
+	graphics := &testGraphics{}
+	go8 := newTestStateGo8(graphics)
+	for i := 0; i < 20; i++ {
+		go8.RunFrame()
+	}
+	var state bytes.Buffer
+	if err := go8.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+	graphics.frames = nil
+	for i := 0; i < 20; i++ {
+		go8.RunFrame()
+	}
+
+	resumedGraphics := &testGraphics{}
+	resumed := newGo8(&testSound{}, resumedGraphics, Quirks{}, nil)
+	if err := resumed.LoadState(&state); err != nil {
+		t.Fatal(err)
+	}
+	if resumed.quirks != go8.quirks {
+		t.Errorf("Wrong quirks. Got %+v, expected %+v.", resumed.quirks, go8.quirks)
+	}
+	for i := 0; i < 20; i++ {
+		resumed.RunFrame()
+	}
+	if !reflect.DeepEqual(graphics.frames, resumedGraphics.frames) {
+		t.Error("Resumed frames differ from the original run.")
+	}
+	resumed.sound, resumed.graphics = go8.sound, go8.graphics
+	if !reflect.DeepEqual(go8, resumed) {
+		t.Error("Resumed machine state differs from the original run.")
+	}
+}
+
+func TestSaveStateFields(t *testing.T) {
+	go8 := Go8{}
+	go8.initialize()
+	go8.V[0xA] = 0x12
+	go8.index = 0x345
+	go8.pc = 0x678
+	go8.stack[2] = 0x9AB
+	go8.sp = 3
+	go8.delayTimer = 0xC
+	go8.soundTimer = 0xD
+	go8.timerPhase = 45
+	go8.gfx[hiresWidth*hiresHeight-1] = 3
+	go8.hires = true
+	go8.plane = 2
+	go8.key[0xF] = 1
+	go8.audio.buffer[0] = 0xAA
+	go8.audio.pitch = 0x70
+	go8.audioLoaded = true
+	go8.rpl[7] = 0x77
+	go8.memory[memorySize-1] = 0xEE
+	go8.quirks = Quirks{LoadStore: true, DisplayWait: true}
+	go8.SetRandomState(0x123456789)
+	var state bytes.Buffer
+	go8.SaveState(&state)
+	loaded := Go8{}
+	if err := loaded.LoadState(&state); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(go8, loaded) {
+		t.Errorf("Wrong state. Got %+v, expected %+v.", loaded, go8)
+	}
+}
+
+func TestLoadStateV1(t *testing.T) {
+	go8 := Go8{}
+	go8.initialize()
+	go8.V[3] = 0x33
+	go8.SetRandomState(0x1234)
+	go8.timerPhase = 30
+	var v1 bytes.Buffer
+	binary.Write(&v1, binary.BigEndian, stateHeader{Magic: [4]byte{'G', 'O', '8', 'S'}, Version: 1})
+	binary.Write(&v1, binary.BigEndian, go8.state().stateV1)
+	binary.Write(&v1, binary.BigEndian, crc32.ChecksumIEEE(v1.Bytes()))
+	loaded := Go8{}
+	if err := loaded.LoadState(&v1); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.V[3] != 0x33 || loaded.RandomState() != 0x1234 || loaded.timerPhase != 0 {
+		t.Errorf("Wrong state from version 1. Got V3 %x, random state %x, timer phase %d, expected 33, 1234, 0.",
+			loaded.V[3], loaded.RandomState(), loaded.timerPhase)
+	}
+}
+
+func TestLoadStateErrors(t *testing.T) {
+	go8 := Go8{}
+	go8.initialize()
+	var buf bytes.Buffer
+	go8.SaveState(&buf)
+	valid := buf.Bytes()
+	corrupt := func(f func(state []byte) []byte) []byte {
+		state := append([]byte{}, valid...)
+		return f(state)
+	}
+	tests := []struct {
+		name  string
+		state []byte
+		err   string
+	}{
+		{"empty", nil, errStateMagic.Error()},
+		{"magic", corrupt(func(s []byte) []byte { s[0] = 'X'; return s }), errStateMagic.Error()},
+		{"version", corrupt(func(s []byte) []byte {
+			binary.BigEndian.PutUint16(s[4:], stateVersion+1)
+			return s
+		}), "unsupported version"},
+		{"memory", corrupt(func(s []byte) []byte { s[0x300] ^= 1; return s }), errStateChecksum.Error()},
+		{"checksum", corrupt(func(s []byte) []byte { s[len(s)-1] ^= 1; return s }), errStateChecksum.Error()},
+		{"truncated", valid[:len(valid)-10], errStateChecksum.Error()},
+	}
+	for _, test := range tests {
+		loaded := Go8{}
+		loaded.initialize()
+		loaded.V[0] = 0x55
+		err := loaded.LoadState(bytes.NewReader(test.state))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: Wrong error. Got %v, expected %s.", test.name, err, test.err)
+		}
+		if loaded.V[0] != 0x55 {
+			t.Errorf("%s: State changed by a failed load.", test.name)
+		}
+	}
+}
+
+func TestSaveSlots(t *testing.T) {
+	if path := slotPath(filepath.Join("roms", "pong.ch8"), 3); path != filepath.Join("roms", "pong.state3") {
+		t.Errorf("Wrong slot path. Got %s.", path)
+	}
+	dir, err := ioutil.TempDir("", "go8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := slotPath(filepath.Join(dir, "game.ch8"), 1)
+	go8 := Go8{}
+	go8.initialize()
+	go8.V[1] = 0x11
+	if err := go8.saveSlot(filename); err != nil {
+		t.Fatal(err)
+	}
+	go8.V[1] = 0x22
+	if err := go8.loadSlot(filename); err != nil {
+		t.Fatal(err)
+	}
+	if go8.V[1] != 0x11 {
+		t.Errorf("Slot not restored. Got V1 %x, expected %x.", go8.V[1], 0x11)
+	}
+	if err := go8.loadSlot(slotPath(filepath.Join(dir, "game.ch8"), 2)); err == nil {
+		t.Error("No error loading an empty slot.")
+	}
+}
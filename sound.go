@@ -1,40 +1,74 @@
+//go:build !js
+// +build !js
+
 package main
 
 import (
-	"os"
 	"time"
 
 	"github.com/faiface/beep"
 	"github.com/faiface/beep/speaker"
-	"github.com/faiface/beep/wav"
 )
 
-// SoundDevice - a generic sound device interfaces
-type SoundDevice interface {
-	playSound()
-}
+const sampleRate = beep.SampleRate(44100)
 
 // Sound - SoundDevice implementation with the github.com/faiface/beep library
 type Sound struct {
-	stream beep.StreamSeekCloser
+	streamer *generatorStreamer
 }
 
-func newSound(filename string) *Sound {
-	f, err := os.Open(filename)
-	check(err)
+// generatorStreamer - beep.Streamer playing the current sound, or silence
+// when there is none
+type generatorStreamer struct {
+	gen generator
+	buf []float64
+}
 
-	s, format, err := wav.Decode(f)
-	check(err)
+// newSound - opens the audio device, returning an error if there is none
+func newSound() (*Sound, error) {
+	if err := speaker.Init(sampleRate, sampleRate.N(time.Second/20)); err != nil {
+		return nil, err
+	}
+	streamer := &generatorStreamer{}
+	speaker.Play(streamer)
+	return &Sound{streamer: streamer}, nil
+}
 
-	speaker.Init(
-		format.SampleRate,
-		format.SampleRate.N(time.Second/10),
-	)
+func (sound *Sound) start(gen generator) {
+	speaker.Lock()
+	sound.streamer.gen = gen
+	speaker.Unlock()
+}
+
+func (sound *Sound) stop() {
+	speaker.Lock()
+	sound.streamer.gen = nil
+	speaker.Unlock()
+}
+
+func (streamer *generatorStreamer) Stream(samples [][2]float64) (n int, ok bool) {
+	if len(streamer.buf) < len(samples) {
+		streamer.buf = make([]float64, len(samples))
+	}
+	buf := streamer.buf[:len(samples)]
+	if streamer.gen == nil {
+		memsetFloat(buf, 0)
+	} else {
+		streamer.gen.generate(buf, int(sampleRate))
+	}
+	for i := range samples {
+		samples[i][0] = buf[i]
+		samples[i][1] = buf[i]
+	}
+	return len(samples), true
+}
 
-	return &Sound{stream: s}
+func (streamer *generatorStreamer) Err() error {
+	return nil
 }
 
-func (sound *Sound) playSound() {
-	speaker.Play(beep.Seq(sound.stream))
-	sound.stream.Seek(0)
+func memsetFloat(arr []float64, val float64) {
+	for i := 0; i < len(arr); i++ {
+		arr[i] = val
+	}
 }
@@ -0,0 +1,15 @@
+//go:build !js
+// +build !js
+
+package main
+
+import "testing"
+
+func TestSound(t *testing.T) {
+	sound, err := newSound()
+	if err != nil {
+		t.Skipf("No audio device: %v", err)
+	}
+	sound.start(newToneGenerator(defaultTone))
+	sound.stop()
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const sourceMapHeader = "; go-8 source map"
+
+// sourceLine - a line in an assembler source file
+type sourceLine struct {
+	file string
+	line int
+}
+
+// sourceMap - the source line of each instruction and the address of each
+// label in a ROM. Written by the assembler, one entry per line:
+//
+//	line 0200 3 main.asm
+//	sym 0200 start
+//
+// File names are relative to the directory of the map.
+type sourceMap struct {
+	lines   map[uint16]sourceLine
+	symbols map[uint16]string
+}
+
+func newSourceMap() *sourceMap {
+	return &sourceMap{
+		lines:   map[uint16]sourceLine{},
+		symbols: map[uint16]string{},
+	}
+}
+
+// sourceMap - the source map of the last program assembled
+func (asm *assembler) sourceMap() *sourceMap {
+	sm := newSourceMap()
+	for _, stmt := range asm.statements {
+		if stmt.spec != nil {
+			sm.lines[stmt.addr] = sourceLine{stmt.op.file, stmt.op.line}
+		}
+	}
+	for _, label := range asm.labels {
+		addr := asm.symbols[label]
+		if _, ok := sm.symbols[addr]; !ok {
+			sm.symbols[addr] = label
+		}
+	}
+	return sm
+}
+
+// write - writes the map with file names relative to dir
+func (sm *sourceMap) write(w io.Writer, dir string) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, sourceMapHeader)
+	for _, addr := range sortedAddrs(sm.lines) {
+		line := sm.lines[addr]
+		file := line.file
+		if abs, err := filepath.Abs(file); err == nil {
+			if rel, err := filepath.Rel(dir, abs); err == nil {
+				file = rel
+			}
+		}
+		fmt.Fprintf(out, "line %04X %d %s\n", addr, line.line, filepath.ToSlash(file))
+	}
+	for _, addr := range sortedAddrs(sm.symbols) {
+		fmt.Fprintf(out, "sym %04X %s\n", addr, sm.symbols[addr])
+	}
+	return out.Flush()
+}
+
+func sortedAddrs(m interface{}) []uint16 {
+	var addrs []uint16
+	switch m := m.(type) {
+	case map[uint16]sourceLine:
+		for addr := range m {
+			addrs = append(addrs, addr)
+		}
+	case map[uint16]string:
+		for addr := range m {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	return addrs
+}
+
+// writeSourceMap - writes the source map of asm to filename
+func writeSourceMap(asm *assembler, filename string) error {
+	dir, err := filepath.Abs(filepath.Dir(filename))
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := asm.sourceMap().write(f, dir); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readSourceMap - reads a map, making file names absolute against dir
+func readSourceMap(r io.Reader, dir string) (*sourceMap, error) {
+	sm := newSourceMap()
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, ";") {
+			continue
+		}
+		fields := strings.SplitN(text, " ", 4)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("source map line %d: too few fields", n)
+		}
+		addr, err := strconv.ParseUint(fields[1], 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("source map line %d: invalid address %q", n, fields[1])
+		}
+		switch {
+		case fields[0] == "sym":
+			sm.symbols[uint16(addr)] = fields[2]
+		case fields[0] == "line" && len(fields) == 4:
+			line, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("source map line %d: invalid line %q", n, fields[2])
+			}
+			file := filepath.FromSlash(fields[3])
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(dir, file)
+			}
+			sm.lines[uint16(addr)] = sourceLine{file, line}
+		default:
+			return nil, fmt.Errorf("source map line %d: unknown entry %q", n, fields[0])
+		}
+	}
+	return sm, scanner.Err()
+}
+
+func loadSourceMap(filename string) (*sourceMap, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dir, err := filepath.Abs(filepath.Dir(filename))
+	if err != nil {
+		return nil, err
+	}
+	return readSourceMap(f, dir)
+}
+
+// address - the first instruction at or after line in file, and the line
+// it is on
+func (sm *sourceMap) address(file string, line int) (uint16, int, bool) {
+	var best uint16
+	bestLine := 0
+	for _, addr := range sortedAddrs(sm.lines) {
+		source := sm.lines[addr]
+		if !sameFile(source.file, file) || source.line < line {
+			continue
+		}
+		if bestLine == 0 || source.line < bestLine {
+			best, bestLine = addr, source.line
+		}
+	}
+	return best, bestLine, bestLine != 0
+}
+
+func sameFile(a, b string) bool {
+	return filepath.Clean(a) == filepath.Clean(b)
+}
+
+// symbol - the label at or closest before addr
+func (sm *sourceMap) symbol(addr uint16) (string, bool) {
+	name, found := "", false
+	for _, symAddr := range sortedAddrs(sm.symbols) {
+		if symAddr > addr {
+			break
+		}
+		name, found = sm.symbols[symAddr], true
+	}
+	return name, found
+}
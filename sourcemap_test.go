@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestFiles - writes files to a new temporary directory
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "go8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestSourceMap(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"main.asm": `start:
+	LD V0, 1
+
+	CALL draw
+	JP start
+include "draw.asm"
+`,
+		"draw.asm": `draw:
+	DRW V0, V0, 1
+	RET
+	db 0xFF
+`,
+	})
+	defer os.RemoveAll(dir)
+	asm := newAssembler()
+	if _, err := asm.assembleFile(filepath.Join(dir, "main.asm")); err != nil {
+		t.Fatal(err)
+	}
+	mapFile := filepath.Join(dir, "main.map")
+	if err := writeSourceMap(asm, mapFile); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(mapFile)
+	if !strings.Contains(string(data), "line 0206 2 draw.asm\n") {
+		t.Errorf("File names not relative to the map. Got:\n%s", data)
+	}
+	sm, err := loadSourceMap(mapFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mainFile, drawFile := filepath.Join(dir, "main.asm"), filepath.Join(dir, "draw.asm")
+	tests := []struct {
+		file string
+		line int
+		addr uint16
+		// line the breakpoint moves to, 0 if there is no code
+		actual int
+	}{
+		{mainFile, 2, 0x200, 2},
+		{mainFile, 3, 0x202, 4},
+		{mainFile, 5, 0x204, 5},
+		{mainFile, 6, 0, 0},
+		{drawFile, 1, 0x206, 2},
+		{drawFile, 3, 0x208, 3},
+		{drawFile, 4, 0, 0},
+	}
+	for _, test := range tests {
+		addr, line, ok := sm.address(test.file, test.line)
+		if ok != (test.actual != 0) || addr != test.addr || line != test.actual {
+			t.Errorf("Wrong address for %s:%d. Got %x line %d, expected %x line %d.",
+				filepath.Base(test.file), test.line, addr, line, test.addr, test.actual)
+		}
+	}
+	symbols := []struct {
+		addr uint16
+		name string
+	}{{0x200, "start"}, {0x204, "start"}, {0x206, "draw"}, {0x20A, "draw"}}
+	for _, test := range symbols {
+		if name, _ := sm.symbol(test.addr); name != test.name {
+			t.Errorf("Wrong symbol for %x. Got %s, expected %s.", test.addr, name, test.name)
+		}
+	}
+	if _, ok := sm.symbol(0x100); ok {
+		t.Error("Symbol found before the program.")
+	}
+}
+
+func TestReadSourceMapErrors(t *testing.T) {
+	tests := []string{
+		"line 0200 main.asm",
+		"line 0200 x main.asm",
+		"sym zz start",
+		"label 0200 start",
+	}
+	for _, test := range tests {
+		if _, err := readSourceMap(strings.NewReader(test), "."); err == nil {
+			t.Errorf("No error for %q.", test)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// terminals only report key presses, repeating them while a key is
+	// held, so a key counts as down for this long after each press. It
+	// has to outlast the keyboard's repeat delay, commonly 500 ms, or a
+	// held key is released before the first repeat arrives.
+	terminalKeyRelease = 600 * time.Millisecond
+	ctrlC              = 0x03
+	escape             = 0x1b
+	// upper half block, drawn with the top pixel as foreground and the
+	// bottom pixel as background colour
+	halfBlock = "▀"
+)
+
+// terminalKeys - the names of the keys that are not letters or digits, by
+// the character they type
+var terminalKeys = map[byte]string{
+	' ': "Space", '\r': "Enter", '\n': "Enter", '\t': "Tab",
+	',': "Comma", '.': "Period", '/': "Slash", ';': "Semicolon", '-': "Minus", '=': "Equal",
+}
+
+// terminalArrows - the arrow keys, by the last byte of the escape sequence
+// they send, ESC [ A for up
+var terminalArrows = map[byte]string{'A': "Up", 'B': "Down", 'C': "Right", 'D': "Left"}
+
+// terminalKeyName - the key name of the character b
+func terminalKeyName(b byte) string {
+	switch {
+	case b >= '0' && b <= '9', b >= 'A' && b <= 'Z':
+		return string(b)
+	case b >= 'a' && b <= 'z':
+		return string(b - 'a' + 'A')
+	}
+	return terminalKeys[b]
+}
+
+// Terminal - GraphicsDevice drawing in a terminal with ANSI escape codes,
+// two pixels to a character cell. Keys are read from the terminal in raw
+// mode; ctrl+C closes it.
+type Terminal struct {
+	out *bufio.Writer
+	pal palette
+	// keypad keys by key name
+	bindings map[string][]int
+	// pixel pairs on screen, the top pixel in the low byte and the bottom
+	// one in the high byte, to only redraw the cells that changed
+	cells []uint16
+	w, h  int
+
+	mu        sync.Mutex
+	lastPress [16]time.Time
+	quit      bool
+	now       func() time.Time
+	release   time.Duration
+	// restores the terminal mode on close
+	restore func() error
+}
+
+func newTerminal(in io.Reader, out io.Writer) *Terminal {
+	term := &Terminal{
+		out:      bufio.NewWriter(out),
+		pal:      defaultPalette,
+		bindings: keymaps[defaultKeymap].bindings(),
+		now:      time.Now,
+		release:  terminalKeyRelease,
+	}
+	go term.readKeys(in)
+	return term
+}
+
+// openTerminal - a Terminal on stdin and stdout, switched to raw mode
+func openTerminal() (*Terminal, error) {
+	restore, err := rawMode()
+	if err != nil {
+		return nil, fmt.Errorf("terminal: %v", err)
+	}
+	term := newTerminal(os.Stdin, os.Stdout)
+	term.restore = restore
+	return term, nil
+}
+
+// rawMode - switches the terminal on stdin to raw mode with stty,
+// returning a function that switches it back
+func rawMode() (func() error, error) {
+	state, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() error {
+		_, err := stty(strings.TrimSpace(state))
+		return err
+	}, nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+func (term *Terminal) readKeys(in io.Reader) {
+	buf := make([]byte, 64)
+	for {
+		n, err := in.Read(buf)
+		term.mu.Lock()
+		for i := 0; i < n; i++ {
+			b := buf[i]
+			if b == ctrlC {
+				term.quit = true
+			}
+			name := terminalKeyName(b)
+			// arrow keys, in normal or application cursor mode
+			if b == escape && i+2 < n && (buf[i+1] == '[' || buf[i+1] == 'O') {
+				name = terminalArrows[buf[i+2]]
+				i += 2
+			}
+			for _, key := range term.bindings[name] {
+				term.lastPress[key] = term.now()
+			}
+		}
+		if err != nil {
+			term.quit = true
+		}
+		term.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// updateWindow - redraws the cells that changed since the last frame,
+// clearing the terminal when the resolution changes
+func (term *Terminal) updateWindow(gfx []uint8, w, h int) {
+	rows := (h + 1) / 2
+	if w != term.w || h != term.h {
+		term.w, term.h = w, h
+		term.cells = make([]uint16, w*rows)
+		for i := range term.cells {
+			// not a pair of display values, so every cell is drawn
+			term.cells[i] = 0xFFFF
+		}
+		term.out.WriteString("\x1b[?25l\x1b[0m\x1b[2J")
+	}
+	fg, bg := -1, -1
+	cursorX, cursorY := -1, -1
+	for y := 0; y < rows; y++ {
+		for x := 0; x < w; x++ {
+			top := int(gfx[2*y*w+x])
+			bottom := 0
+			if 2*y+1 < h {
+				bottom = int(gfx[(2*y+1)*w+x])
+			}
+			cell := uint16(top | bottom<<8)
+			if term.cells[y*w+x] == cell {
+				continue
+			}
+			term.cells[y*w+x] = cell
+			if x != cursorX || y != cursorY {
+				fmt.Fprintf(term.out, "\x1b[%d;%dH", y+1, x+1)
+			}
+			if top != fg {
+				c := term.pal.color(uint8(top))
+				fmt.Fprintf(term.out, "\x1b[38;2;%d;%d;%dm", c.R, c.G, c.B)
+				fg = top
+			}
+			if bottom != bg {
+				c := term.pal.color(uint8(bottom))
+				fmt.Fprintf(term.out, "\x1b[48;2;%d;%d;%dm", c.R, c.G, c.B)
+				bg = bottom
+			}
+			term.out.WriteString(halfBlock)
+			cursorX, cursorY = x+1, y
+		}
+	}
+	if fg != -1 {
+		term.out.WriteString("\x1b[0m")
+	}
+	term.out.Flush()
+}
+
+// setKeymap - changes the keys that press the keypad keys
+func (term *Terminal) setKeymap(km keymap) {
+	term.mu.Lock()
+	defer term.mu.Unlock()
+	term.bindings = km.bindings()
+}
+
+func (term *Terminal) closed() bool {
+	term.mu.Lock()
+	defer term.mu.Unlock()
+	return term.quit
+}
+
+func (term *Terminal) pressed(key int) bool {
+	term.mu.Lock()
+	defer term.mu.Unlock()
+	last := term.lastPress[key]
+	return !last.IsZero() && term.now().Sub(last) < term.release
+}
+
+// close - moves the cursor below the display and restores the terminal,
+// safe to call more than once
+func (term *Terminal) close() {
+	fmt.Fprintf(term.out, "\x1b[0m\x1b[?25h\x1b[%d;1H\r\n", (term.h+1)/2+1)
+	term.out.Flush()
+	if term.restore != nil {
+		term.restore()
+		term.restore = nil
+	}
+}
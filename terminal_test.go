@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTerminalRedraw(t *testing.T) {
+	tests := []struct {
+		name string
+		w, h int
+	}{
+		{"lores", screenWidth, screenHeight},
+		{"hires", hiresWidth, hiresHeight},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		in, _ := io.Pipe()
+		term := newTerminal(in, &out)
+		gfx := make([]uint8, test.w*test.h)
+		term.updateWindow(gfx, test.w, test.h)
+		cells := test.w * test.h / 2
+		if n := strings.Count(out.String(), halfBlock); n != cells {
+			t.Errorf("%s: Wrong number of cells drawn. Got %d, expected %d.", test.name, n, cells)
+		}
+		out.Reset()
+		term.updateWindow(gfx, test.w, test.h)
+		if out.Len() != 0 {
+			t.Errorf("%s: Unchanged frame redrawn. Got %q.", test.name, out.String())
+		}
+		// pixel 3 of row 5 is the bottom half of cell 3 on terminal row 3
+		gfx[5*test.w+3] = 1
+		term.updateWindow(gfx, test.w, test.h)
+		expected := "\x1b[3;4H\x1b[38;2;0;0;0m\x1b[48;2;255;255;255m" + halfBlock + "\x1b[0m"
+		if out.String() != expected {
+			t.Errorf("%s: Wrong redraw. Got %q, expected %q.", test.name, out.String(), expected)
+		}
+	}
+}
+
+func TestTerminalKeys(t *testing.T) {
+	in, keys := io.Pipe()
+	term := newTerminal(in, &bytes.Buffer{})
+	clock := time.Unix(100, 0)
+	term.mu.Lock()
+	term.now = func() time.Time { return clock }
+	term.mu.Unlock()
+	waitFor := func(what string, f func() bool) {
+		for start := time.Now(); !f(); time.Sleep(time.Millisecond) {
+			if time.Since(start) > time.Second {
+				t.Fatalf("Timed out waiting for %s.", what)
+			}
+		}
+	}
+
+	keys.Write([]byte("W"))
+	waitFor("key 5", func() bool { return term.pressed(0x5) })
+	if term.pressed(0x4) {
+		t.Error("Key 4 pressed without input.")
+	}
+	// still held when a typical 500 ms keyboard repeat delay has passed
+	term.mu.Lock()
+	clock = clock.Add(500 * time.Millisecond)
+	term.mu.Unlock()
+	if !term.pressed(0x5) {
+		t.Error("Key 5 released before the keyboard repeat delay.")
+	}
+	term.mu.Lock()
+	clock = clock.Add(terminalKeyRelease - 500*time.Millisecond)
+	term.mu.Unlock()
+	if term.pressed(0x5) {
+		t.Error("Key 5 not released after the timeout.")
+	}
+
+	if term.closed() {
+		t.Error("Terminal closed without input.")
+	}
+	keys.Write([]byte{ctrlC})
+	waitFor("ctrl+C", term.closed)
+}
+
+func TestTerminalKeymap(t *testing.T) {
+	in, keys := io.Pipe()
+	term := newTerminal(in, &bytes.Buffer{})
+	km, _ := getKeymap("arrows")
+	term.setKeymap(km)
+	tests := []struct {
+		input string
+		key   int
+	}{
+		{"\x1b[A", 0x2},
+		{"\x1bOD", 0x4},
+		{" ", 0x5},
+		{"x", 0x0},
+	}
+	for _, test := range tests {
+		keys.Write([]byte(test.input))
+		for start := time.Now(); !term.pressed(test.key); time.Sleep(time.Millisecond) {
+			if time.Since(start) > time.Second {
+				t.Fatalf("%q: Timed out waiting for key %X.", test.input, test.key)
+			}
+		}
+	}
+	// the A of the escape sequence is not the letter A
+	if term.pressed(0x7) {
+		t.Error("Key 7 pressed by an arrow key.")
+	}
+}
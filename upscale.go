@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// scaleFunc - writes the w by h display gfx to out, scaled up by the
+// upscaler's factor
+type scaleFunc func(out, gfx []uint8, w, h int)
+
+// upscalers - pixel art scaling algorithms by name. They smooth diagonal
+// edges by only looking at which neighbouring pixels are equal, so they
+// work on display values of any plane or fade level. Nearest neighbour
+// scaling is what the window does anyway.
+var upscalers = map[string]struct {
+	factor int
+	scale  scaleFunc
+}{
+	"nearest": {1, nil},
+	"scale2x": {2, scale2x},
+	"scale3x": {3, scale3x},
+	"epx":     {2, epx},
+}
+
+// getUpscaler - the upscaler named name, nil for nearest
+func getUpscaler(name string) (*upscaler, error) {
+	u, ok := upscalers[name]
+	if !ok {
+		var names []string
+		for name := range upscalers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown upscaler %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+	if u.scale == nil {
+		return nil, nil
+	}
+	return &upscaler{factor: u.factor, scale: u.scale}, nil
+}
+
+// upscaler - scales the display up before it is drawn
+type upscaler struct {
+	factor int
+	scale  scaleFunc
+	out    []uint8
+}
+
+// apply - the display gfx scaled up and its size. The result is only valid
+// until the next call.
+func (u *upscaler) apply(gfx []uint8, w, h int) ([]uint8, int, int) {
+	if size := len(gfx) * u.factor * u.factor; len(u.out) != size {
+		u.out = make([]uint8, size)
+	}
+	u.scale(u.out, gfx, w, h)
+	return u.out, w * u.factor, h * u.factor
+}
+
+// pixelAt - the pixel at x, y, repeating the edge pixels outside the display
+func pixelAt(gfx []uint8, w, h, x, y int) uint8 {
+	if x < 0 {
+		x = 0
+	} else if x >= w {
+		x = w - 1
+	}
+	if y < 0 {
+		y = 0
+	} else if y >= h {
+		y = h - 1
+	}
+	return gfx[y*w+x]
+}
+
+// scale2x - AdvanceMAME's Scale2x. Each pixel P becomes four, each taking
+// the colour of the two neighbours it touches if they are equal, unless
+// that would fill a straight edge:
+//
+//	  A          1 2
+//	C P B  ->    3 4
+//	  D
+func scale2x(out, gfx []uint8, w, h int) {
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p := gfx[y*w+x]
+			a := pixelAt(gfx, w, h, x, y-1)
+			b := pixelAt(gfx, w, h, x+1, y)
+			c := pixelAt(gfx, w, h, x-1, y)
+			d := pixelAt(gfx, w, h, x, y+1)
+			e1, e2, e3, e4 := p, p, p, p
+			if c == a && c != d && a != b {
+				e1 = a
+			}
+			if a == b && a != c && b != d {
+				e2 = b
+			}
+			if d == c && d != b && c != a {
+				e3 = c
+			}
+			if b == d && b != a && d != c {
+				e4 = d
+			}
+			i := 2*y*2*w + 2*x
+			out[i], out[i+1] = e1, e2
+			out[i+2*w], out[i+2*w+1] = e3, e4
+		}
+	}
+}
+
+// epx - Eric's Pixel Expansion, which Scale2x restates: the same images
+// from the same neighbours, except that where three or four of them are
+// equal the pixel is left as it is.
+func epx(out, gfx []uint8, w, h int) {
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p := gfx[y*w+x]
+			a := pixelAt(gfx, w, h, x, y-1)
+			b := pixelAt(gfx, w, h, x+1, y)
+			c := pixelAt(gfx, w, h, x-1, y)
+			d := pixelAt(gfx, w, h, x, y+1)
+			e1, e2, e3, e4 := p, p, p, p
+			if c == a {
+				e1 = a
+			}
+			if a == b {
+				e2 = b
+			}
+			if d == c {
+				e3 = c
+			}
+			if b == d {
+				e4 = d
+			}
+			if (a == b && (a == c || a == d)) || (c == d && (c == a || c == b)) {
+				e1, e2, e3, e4 = p, p, p, p
+			}
+			i := 2*y*2*w + 2*x
+			out[i], out[i+1] = e1, e2
+			out[i+2*w], out[i+2*w+1] = e3, e4
+		}
+	}
+}
+
+// scale3x - AdvanceMAME's Scale3x, each pixel E becoming nine from its
+// eight neighbours:
+//
+//	A B C        1 2 3
+//	D E F  ->    4 5 6
+//	G H I        7 8 9
+func scale3x(out, gfx []uint8, width, height int) {
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			e := gfx[y*width+x]
+			a := pixelAt(gfx, width, height, x-1, y-1)
+			b := pixelAt(gfx, width, height, x, y-1)
+			c := pixelAt(gfx, width, height, x+1, y-1)
+			d := pixelAt(gfx, width, height, x-1, y)
+			f := pixelAt(gfx, width, height, x+1, y)
+			g := pixelAt(gfx, width, height, x-1, y+1)
+			h := pixelAt(gfx, width, height, x, y+1)
+			i := pixelAt(gfx, width, height, x+1, y+1)
+			e1, e2, e3, e4, e6, e7, e8, e9 := e, e, e, e, e, e, e, e
+			// the corners of the diamond around E
+			topLeft := d == b && b != f && d != h
+			topRight := b == f && b != d && f != h
+			bottomLeft := d == h && d != b && h != f
+			bottomRight := h == f && d != h && b != f
+			if topLeft {
+				e1 = d
+			}
+			if (topLeft && e != c) || (topRight && e != a) {
+				e2 = b
+			}
+			if topRight {
+				e3 = f
+			}
+			if (topLeft && e != g) || (bottomLeft && e != a) {
+				e4 = d
+			}
+			if (topRight && e != i) || (bottomRight && e != c) {
+				e6 = f
+			}
+			if bottomLeft {
+				e7 = d
+			}
+			if (bottomLeft && e != i) || (bottomRight && e != g) {
+				e8 = h
+			}
+			if bottomRight {
+				e9 = f
+			}
+			row := 3 * width
+			j := 3*y*row + 3*x
+			out[j], out[j+1], out[j+2] = e1, e2, e3
+			out[j+row], out[j+row+1], out[j+row+2] = e4, e, e6
+			out[j+2*row], out[j+2*row+1], out[j+2*row+2] = e7, e8, e9
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// parsePattern - a display from rows of # for set pixels and . for unset
+func parsePattern(rows ...string) ([]uint8, int, int) {
+	gfx := make([]uint8, 0, len(rows)*len(rows[0]))
+	for _, row := range rows {
+		for _, c := range row {
+			if c == '#' {
+				gfx = append(gfx, 1)
+			} else {
+				gfx = append(gfx, 0)
+			}
+		}
+	}
+	return gfx, len(rows[0]), len(rows)
+}
+
+func formatPattern(gfx []uint8, w int) string {
+	var b strings.Builder
+	for i, p := range gfx {
+		if p != 0 {
+			b.WriteByte('#')
+		} else {
+			b.WriteByte('.')
+		}
+		if i%w == w-1 {
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+func TestUpscale(t *testing.T) {
+	diagonal := []string{
+		"#..",
+		".#.",
+		"..#",
+	}
+	tests := []struct {
+		name     string
+		pattern  []string
+		expected []string
+	}{
+		{"scale2x", []string{".#."}, []string{
+			"..##..",
+			"..##..",
+		}},
+		{"scale2x", diagonal, []string{
+			"##....",
+			"#.#...",
+			".###..",
+			"..###.",
+			"...#.#",
+			"....##",
+		}},
+		// a straight edge stays straight
+		{"scale2x", []string{
+			"##",
+			"..",
+		}, []string{
+			"####",
+			"####",
+			"....",
+			"....",
+		}},
+		{"epx", diagonal, []string{
+			"##....",
+			"#.#...",
+			".###..",
+			"..###.",
+			"...#.#",
+			"....##",
+		}},
+		{"scale3x", []string{".#."}, []string{
+			"...###...",
+			"...###...",
+			"...###...",
+		}},
+		{"scale3x", diagonal, []string{
+			"###......",
+			"##.#.....",
+			"#..#.....",
+			".#####...",
+			"...###...",
+			"...#####.",
+			".....#..#",
+			".....#.##",
+			"......###",
+		}},
+	}
+	for _, test := range tests {
+		u, err := getUpscaler(test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gfx, w, h := parsePattern(test.pattern...)
+		out, outW, outH := u.apply(gfx, w, h)
+		if outW != w*u.factor || outH != h*u.factor {
+			t.Errorf("%s: Wrong size. Got %dx%d, expected %dx%d.", test.name, outW, outH, w*u.factor, h*u.factor)
+			continue
+		}
+		expected := strings.Join(test.expected, "\n") + "\n"
+		if got := formatPattern(out, outW); got != expected {
+			t.Errorf("%s: Wrong pixels. Got\n%sexpected\n%s", test.name, got, expected)
+		}
+	}
+}
+
+// EPX and Scale2x state their rules differently but give the same images
+func TestEPXMatchesScale2x(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	gfx := make([]uint8, screenWidth*screenHeight)
+	for i := range gfx {
+		gfx[i] = uint8(rng.Intn(4))
+	}
+	a, b := make([]uint8, 4*len(gfx)), make([]uint8, 4*len(gfx))
+	scale2x(a, gfx, screenWidth, screenHeight)
+	epx(b, gfx, screenWidth, screenHeight)
+	if string(a) != string(b) {
+		t.Errorf("EPX and Scale2x differ.")
+	}
+}
+
+func TestGetUpscaler(t *testing.T) {
+	if u, err := getUpscaler("nearest"); u != nil || err != nil {
+		t.Errorf("nearest: Wrong upscaler. Got %v, %v, expected nil.", u, err)
+	}
+	if _, err := getUpscaler("hq4x"); err == nil {
+		t.Errorf("hq4x: Expected an error.")
+	}
+}
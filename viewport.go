@@ -0,0 +1,28 @@
+package main
+
+import "math"
+
+// viewport - where to draw a w by h frame buffer in a window of winW by
+// winH with at least margin left around it: the size of a display pixel and
+// the offset of the display from the bottom left corner. The display keeps
+// its 2:1 aspect ratio and the same size in lores and hires, letterboxed in
+// the middle of the window. With integer set the smallest pixels, hires or
+// upscaled, are a whole number of window pixels, and never less than one.
+func viewport(winW, winH, margin float64, w, h int, integer bool) (pixelSize, x, y float64) {
+	// the display in its smallest pixels, a lores pixel being two hires ones
+	unitW := math.Max(float64(w), hiresWidth)
+	unitH := unitW * float64(h) / float64(w)
+	scale := math.Min((winW-2*margin)/unitW, (winH-2*margin)/unitH)
+	if integer {
+		scale = math.Max(1, math.Floor(scale))
+	}
+	scale = math.Max(0, scale)
+	pixelSize = scale * unitW / float64(w)
+	x = (winW - pixelSize*float64(w)) / 2
+	y = (winH - pixelSize*float64(h)) / 2
+	if integer {
+		// whole window pixels, so display pixels do not straddle two
+		x, y = math.Floor(x), math.Floor(y)
+	}
+	return pixelSize, x, y
+}
@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestViewport(t *testing.T) {
+	tests := []struct {
+		name       string
+		winW, winH float64
+		margin     float64
+		w, h       int
+		integer    bool
+		size, x, y float64
+	}{
+		{"initial lores", 660, 340, 10, screenWidth, screenHeight, false, 10, 10, 10},
+		{"initial hires", 660, 340, 10, hiresWidth, hiresHeight, false, 5, 10, 10},
+		// wider than 2:1, letterboxed left and right
+		{"wide", 1000, 200, 0, hiresWidth, hiresHeight, false, 3.125, 300, 0},
+		// taller than 2:1, letterboxed top and bottom
+		{"tall", 256, 1000, 0, screenWidth, screenHeight, false, 4, 0, 436},
+		{"fractional", 3840, 2160, 0, hiresWidth, hiresHeight, false, 30, 0, 120},
+		{"integer hires", 1000, 600, 0, hiresWidth, hiresHeight, true, 7, 52, 76},
+		// lores pixels are two hires pixels
+		{"integer lores", 1000, 600, 0, screenWidth, screenHeight, true, 14, 52, 76},
+		{"integer odd offset", 261, 200, 0, hiresWidth, hiresHeight, true, 2, 2, 36},
+		// upscaled by 3, the display is 384x192
+		{"integer scale3x", 1000, 600, 0, 3 * hiresWidth, 3 * hiresHeight, true, 2, 116, 108},
+		{"scale3x", 768, 384, 0, 3 * screenWidth, 3 * screenHeight, false, 4, 0, 0},
+		// never below one pixel even if the display does not fit
+		{"integer tiny", 100, 50, 0, hiresWidth, hiresHeight, true, 1, -14, -7},
+		{"tiny", 10, 10, 10, hiresWidth, hiresHeight, false, 0, 5, 5},
+	}
+	for _, test := range tests {
+		size, x, y := viewport(test.winW, test.winH, test.margin, test.w, test.h, test.integer)
+		if size != test.size || x != test.x || y != test.y {
+			t.Errorf("%s: Wrong viewport. Got size %g at %g,%g, expected %g at %g,%g.",
+				test.name, size, x, y, test.size, test.x, test.y)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+// Starts go8.wasm and runs a ROM picked with the file input, or the one at
+// the rom URL parameter, e.g.
+// index.html?rom=roms/pong.ch8&quirks=vip&palette=octo&keymap=arrows
+const params = new URLSearchParams(location.search);
+const quirks = params.get("quirks") || "xochip";
+const palette = params.get("palette") || "default";
+const keymap = params.get("keymap") || "vip";
+const status = document.getElementById("status");
+
+window.go8Error = message => {
+  status.textContent = message;
+};
+
+function start(data) {
+  const err = go8Start(new Uint8Array(data), quirks, palette, keymap);
+  status.textContent = err || "";
+}
+
+const go = new Go();
+WebAssembly.instantiateStreaming(fetch("go8.wasm"), go.importObject).then(result => {
+  go.run(result.instance);
+  document.getElementById("rom").addEventListener("change", event => {
+    const file = event.target.files[0];
+    if (file) {
+      file.arrayBuffer().then(start);
+    }
+  });
+  const url = params.get("rom");
+  if (url) {
+    fetch(url)
+      .then(response => {
+        if (!response.ok) {
+          throw new Error(`${url}: ${response.status} ${response.statusText}`);
+        }
+        return response.arrayBuffer();
+      })
+      .then(start)
+      .catch(err => go8Error(err.message));
+  }
+}).catch(err => go8Error(err.message));
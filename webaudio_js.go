@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"syscall/js"
+)
+
+// WebAudio - SoundDevice playing through the Web Audio API
+type WebAudio struct {
+	ctx js.Value
+	// the looping sound, undefined when none is playing
+	source js.Value
+}
+
+func newWebAudio() *WebAudio {
+	ctx := js.Global().Get("AudioContext").New()
+	// browsers keep audio suspended until the user interacts with the page
+	resume := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		ctx.Call("resume")
+		return nil
+	})
+	document := js.Global().Get("document")
+	document.Call("addEventListener", "keydown", resume)
+	document.Call("addEventListener", "pointerdown", resume)
+	return &WebAudio{ctx: ctx, source: js.Undefined()}
+}
+
+// start - loops a buffer holding a whole number of periods of gen, about
+// half a second long
+func (audio *WebAudio) start(gen generator) {
+	audio.stop()
+	sampleRate := audio.ctx.Get("sampleRate").Float()
+	period := gen.period() * sampleRate
+	samples := make([]float64, int(math.Max(1, math.Round(period*math.Ceil(sampleRate/2/period)))))
+	gen.generate(samples, int(sampleRate))
+
+	buffer := audio.ctx.Call("createBuffer", 1, len(samples), sampleRate)
+	data := make([]byte, 4*len(samples))
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(float32(sample)))
+	}
+	channel := buffer.Call("getChannelData", 0)
+	bytes := js.Global().Get("Uint8Array").New(channel.Get("buffer"), channel.Get("byteOffset"), channel.Get("byteLength"))
+	js.CopyBytesToJS(bytes, data)
+
+	audio.source = audio.ctx.Call("createBufferSource")
+	audio.source.Set("buffer", buffer)
+	audio.source.Set("loop", true)
+	audio.source.Call("connect", audio.ctx.Get("destination"))
+	audio.source.Call("start")
+}
+
+func (audio *WebAudio) stop() {
+	if !audio.source.IsUndefined() {
+		audio.source.Call("stop")
+		audio.source = js.Undefined()
+	}
+}